@@ -0,0 +1,111 @@
+package api
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+)
+
+// 客户端发送队列统计，可以在任意 goroutine 中读取
+type clientStats struct {
+	audioDropped atomic.Uint64 // 累计丢弃的音频帧
+	dropStreak   atomic.Int64  // 连续丢弃的音频帧，成功入队后清零
+}
+
+// 投递音频帧，队列满时按 config.SlowConsumerPolicy 丢弃：语音宁可丢掉过时的数据也不要断开
+func (c *Client) enqueueAudio(msg outbound) bool {
+	select {
+	case c.audio <- msg:
+		c.stats.dropStreak.Store(0)
+		return true
+	default:
+	}
+
+	c.stats.audioDropped.Add(1)
+	streak := c.stats.dropStreak.Add(1)
+	switch config.SlowConsumerPolicy {
+	case config.SlowDropOldest:
+		// writePump 可能同时在取，腾不出位置时放弃这一帧
+		select {
+		case <-c.audio:
+		default:
+		}
+		select {
+		case c.audio <- msg:
+			return true
+		default:
+			return false
+		}
+	case config.SlowDisconnect:
+		if streak > int64(config.SlowConsumerMaxDrops) {
+			c.disconnectSlow()
+		}
+	}
+	return false
+}
+
+// 发送队列跟不上时断开连接（可以恢复会话）。队列满时每一帧都会走到这里，只触发一次
+func (c *Client) disconnectSlow() {
+	if c.slow.CompareAndSwap(false, true) {
+		go c.disconnectWith(websocket.CloseTryAgainLater, "网络过慢")
+	}
+}
+
+type clientStatsData struct {
+	UserID        string `json:"user_id"`
+	SessionID     string `json:"session_id"`
+	Connected     bool   `json:"connected"` // 为 false 表示已断线，正在等待恢复
+	ControlQueued int    `json:"control_queued"`
+	AudioQueued   int    `json:"audio_queued"`
+	AudioDropped  uint64 `json:"audio_dropped"`
+	DropStreak    int64  `json:"drop_streak"`
+}
+
+func (c *Client) statsData() clientStatsData {
+	connected := true
+	select {
+	case <-c.done:
+		connected = false
+	default:
+	}
+	return clientStatsData{
+		UserID:        c.userID,
+		SessionID:     c.sessionID,
+		Connected:     connected,
+		ControlQueued: len(c.send),
+		AudioQueued:   len(c.audio),
+		AudioDropped:  c.stats.audioDropped.Load(),
+		DropStreak:    c.stats.dropStreak.Load(),
+	}
+}
+
+// 房间内各连接的发送队列统计，按丢弃帧数从多到少排序
+func (h *RoomHub) stats(roomID string) []clientStatsData {
+	list := []clientStatsData{}
+	h.do(roomID, func(r *room) {
+		for _, peer := range r.members {
+			list = append(list, peer.statsData())
+		}
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].AudioDropped > list[j].AudioDropped
+	})
+	return list
+}
+
+// 查看房间成员的发送队列和丢帧统计（仅房主）
+func GetRoomStats(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	c.JSON(200, gin.H{
+		"code":    20000,
+		"policy":  config.SlowConsumerPolicy,
+		"clients": Hub.stats(room.JoinCode),
+	})
+}
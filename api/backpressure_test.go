@@ -0,0 +1,55 @@
+package api
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+)
+
+// disconnect 策略下，队列满后每一帧都超过阈值，断开只能触发一次
+func TestSlowDisconnectFiresOnce(t *testing.T) {
+	oldPolicy, oldMax := config.SlowConsumerPolicy, config.SlowConsumerMaxDrops
+	config.SlowConsumerPolicy, config.SlowConsumerMaxDrops = config.SlowDisconnect, 2
+	t.Cleanup(func() { config.SlowConsumerPolicy, config.SlowConsumerMaxDrops = oldPolicy, oldMax })
+
+	c := newTestClient("SLOW01", "alice")
+	Hub.join(c)
+	defer closeAll(t, c)
+
+	// 让房间 goroutine 暂停，断开时离开房间的 goroutine 都会停在这里，便于计数
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+	go c.room.do(func(*room) {
+		close(blocked)
+		<-release
+	})
+	<-blocked
+
+	frame := outbound{kind: websocket.BinaryMessage, data: []byte{1}}
+	for len(c.audio) < cap(c.audio) {
+		c.enqueue(frame)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 500; i++ {
+		c.enqueue(frame)
+	}
+	time.Sleep(50 * time.Millisecond)
+	spawned := runtime.NumGoroutine() - before
+	close(release)
+
+	if spawned > 1 {
+		t.Fatalf("连续丢帧时启动了 %d 个断开 goroutine，期望 1", spawned)
+	}
+	select {
+	case <-c.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("慢速客户端没有被断开")
+	}
+	if got := c.stats.audioDropped.Load(); got != 500 {
+		t.Fatalf("丢弃 %d 帧，期望 500", got)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// 建立 n 条真实的 WebSocket 连接，返回服务端一侧的客户端；对端只读取并丢弃收到的帧
+func benchConns(b *testing.B, n int, compress bool) []*Client {
+	conns := make(chan *websocket.Conn, n)
+	up := websocket.Upgrader{EnableCompression: compress}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			b.Errorf("升级失败: %v", err)
+			return
+		}
+		conns <- conn
+	}))
+	b.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{EnableCompression: compress}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	clients := make([]*Client, n)
+	for i := range clients {
+		peer, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			b.Fatalf("连接失败: %v", err)
+		}
+		b.Cleanup(func() { peer.Close() })
+		go func() {
+			for {
+				_, r, err := peer.NextReader()
+				if err != nil {
+					return
+				}
+				io.Copy(io.Discard, r)
+			}
+		}()
+		clients[i] = &Client{conn: <-conns}
+		b.Cleanup(func() { clients[i].conn.Close() })
+	}
+	return clients
+}
+
+// 对比广播同一帧的两种方式：逐个连接 WriteMessage（每条连接各自分帧、压缩），
+// 和 PreparedMessage（只分帧、压缩一次，所有连接共用）。
+// PreparedMessage 只在压缩控制消息时更快，不压缩时构造它的开销超过节省的部分，见 outbound.prepare。
+func benchBroadcast(b *testing.B, n int) {
+	msg, _ := newMessage(MsgChat, "alice", chatData{Text: strings.Repeat("大家好，今天的会议现在开始。", 10)})
+	control, err := msg.frame()
+	if err != nil {
+		b.Fatal(err)
+	}
+	audio := outbound{kind: websocket.BinaryMessage, data: make([]byte, 160)}
+
+	cases := []struct {
+		name     string
+		frame    outbound
+		compress bool
+	}{
+		{"control", control, false},
+		{"control-deflate", control, true},
+		{"audio", audio, false},
+		{"audio-deflate", audio, true}, // 音频不压缩，见 writeFrame
+	}
+	for _, tc := range cases {
+		clients := benchConns(b, n, tc.compress)
+
+		b.Run(tc.name+"/WriteMessage", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, c := range clients {
+					if err := c.writeFrame(tc.frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(tc.name+"/PreparedMessage", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// 每次广播构造一次
+				frame := tc.frame
+				frame.prepared, _ = websocket.NewPreparedMessage(frame.kind, frame.data)
+				for _, c := range clients {
+					if err := c.writeFrame(frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBroadcast10(b *testing.B) { benchBroadcast(b, 10) }
+
+func BenchmarkBroadcast50(b *testing.B) { benchBroadcast(b, 50) }
@@ -0,0 +1,312 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+)
+
+// 多实例部署：同一房间的成员可能连接在不同实例上。
+//
+// 房间 goroutine 启动时订阅 config.Broker 上该房间的频道，本实例产生的广播（控制消息、音频）和
+// 定向信令都会发布到频道，其他实例收到后转发给各自的成员；控制消息在每个实例上重新编号，
+// 因此 seq 和恢复会话都只在同一实例内有效。各实例定期公布自己的在线成员，用于名单和清理异常退出的实例。
+const (
+	clusterQueue            = 1024             // 房间收发队列长度，满时丢弃
+	clusterAnnounceInterval = 15 * time.Second // 公布本实例成员的间隔
+	clusterNodeTimeout      = 3 * clusterAnnounceInterval
+)
+
+// 实例间消息类型
+const (
+	clusterFrame    = "frame"    // 广播帧，控制消息或音频
+	clusterDirect   = "direct"   // 发给指定成员的帧（信令）
+	clusterSync     = "sync"     // 房间在本实例上线，请其他实例公布成员
+	clusterAnnounce = "announce" // 本实例当前的全部成员
+	clusterKick     = "kick"     // 移出成员
+	clusterClose    = "close"    // 关闭房间
+)
+
+// 当前实例ID，用于忽略自己发布的消息
+var nodeID = newNodeID()
+
+func newNodeID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		host, _ := os.Hostname()
+		return host + "-" + strconv.Itoa(os.Getpid())
+	}
+	return hex.EncodeToString(b)
+}
+
+// 实例间消息头，编码为一行 JSON，帧数据原样跟在换行符之后
+type clusterEvent struct {
+	Node         string        `json:"node"`
+	Type         string        `json:"type"`
+	Kind         int           `json:"kind,omitempty"` // 帧类型，websocket.TextMessage 或 websocket.BinaryMessage
+	To           string        `json:"to,omitempty"`
+	Participants []participant `json:"participants,omitempty"`
+	UserID       string        `json:"user_id,omitempty"`
+	IP           string        `json:"ip,omitempty"`
+	Reason       string        `json:"reason,omitempty"`
+	By           string        `json:"by,omitempty"`
+
+	data []byte
+}
+
+func (ev *clusterEvent) encode() ([]byte, error) {
+	header, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, len(header)+1+len(ev.data))
+	payload = append(payload, header...)
+	payload = append(payload, '\n')
+	return append(payload, ev.data...), nil
+}
+
+func decodeClusterEvent(payload []byte) (clusterEvent, error) {
+	var ev clusterEvent
+	i := bytes.IndexByte(payload, '\n')
+	if i < 0 {
+		return ev, errors.New("缺少消息头")
+	}
+	if err := json.Unmarshal(payload[:i], &ev); err != nil {
+		return ev, err
+	}
+	ev.data = payload[i+1:]
+	return ev, nil
+}
+
+// 其他实例上的成员
+type remoteMember struct {
+	node string
+	participant
+}
+
+// 订阅房间频道并启动发布 goroutine，返回退出时的清理函数，只在 run 开始时调用
+func (r *room) joinCluster() func() {
+	relays.Add(1)
+	go func() {
+		defer relays.Done()
+		for payload := range r.outbox {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if _, err := config.Broker.Publish(ctx, r.code, payload); err != nil {
+				log.Printf("房间 %s 发布消息失败: %v", r.code, err)
+			}
+			cancel()
+		}
+	}()
+
+	unsubscribe, err := config.Broker.Subscribe(context.Background(), r.code, r.receive)
+	if err != nil {
+		// 退化为只在本实例内广播
+		log.Printf("房间 %s 订阅失败: %v", r.code, err)
+		unsubscribe = func() {}
+	}
+	r.relay(clusterEvent{Type: clusterSync}, nil)
+
+	return func() {
+		unsubscribe()
+		close(r.outbox)
+	}
+}
+
+// broker 回调：忽略本实例发布的消息，其余交给房间 goroutine 处理
+func (r *room) receive(payload []byte) {
+	ev, err := decodeClusterEvent(payload)
+	if err != nil {
+		log.Printf("房间 %s 收到无法解析的消息: %v", r.code, err)
+		return
+	}
+	if ev.Node == nodeID {
+		return
+	}
+	select {
+	case r.inbox <- ev:
+	case <-r.done:
+	default:
+		log.Printf("房间 %s 处理过慢，丢弃来自实例 %s 的消息", r.code, ev.Node)
+	}
+}
+
+// 发布到其他实例，不等待发送完成，只在房间 goroutine 中调用
+func (r *room) relay(ev clusterEvent, data []byte) {
+	ev.Node = nodeID
+	ev.data = data
+	payload, err := ev.encode()
+	if err != nil {
+		log.Printf("序列化实例间消息失败: %v", err)
+		return
+	}
+	select {
+	case r.outbox <- payload:
+	default:
+		// 音频丢帧不记录，避免刷屏
+		if ev.Kind != websocket.BinaryMessage {
+			log.Printf("房间 %s 发布队列已满，丢弃 %s 消息", r.code, ev.Type)
+		}
+	}
+}
+
+// 将本实例的广播帧转发到其他实例，音频只在其他实例上有成员时转发
+func (r *room) relayFrame(msg outbound) {
+	if msg.kind == websocket.BinaryMessage && len(r.remote) == 0 {
+		return
+	}
+	r.relay(clusterEvent{Type: clusterFrame, Kind: msg.kind}, msg.data)
+}
+
+// 处理其他实例发来的消息，只在房间 goroutine 中调用
+func (r *room) handleRemote(ev clusterEvent) {
+	r.nodes[ev.Node] = time.Now()
+
+	switch ev.Type {
+	case clusterFrame:
+		if ev.Kind == websocket.BinaryMessage {
+			r.fanout(outbound{kind: websocket.BinaryMessage, data: ev.data}, "")
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(ev.data, &msg); err != nil {
+			log.Printf("房间 %s 收到无法解析的控制消息: %v", r.code, err)
+			return
+		}
+		r.applyRemote(ev.Node, &msg)
+		r.deliver(&msg)
+	case clusterDirect:
+		frame := outbound{kind: ev.Kind, data: ev.data}
+		for sid, peer := range r.members {
+			if peer.userID == ev.To || sid == ev.To {
+				peer.enqueue(frame)
+			}
+		}
+	case clusterSync:
+		r.announce()
+	case clusterAnnounce:
+		r.applyAnnounce(ev.Node, ev.Participants)
+	case clusterKick:
+		go kickClients(r.kickTargets(ev.UserID, ev.IP), ev.Reason, ev.By)
+	case clusterClose:
+		r.evict(ev.Reason)
+		go stopRecording(r.code)
+	}
+}
+
+// 根据其他实例广播的控制消息更新远端成员状态
+func (r *room) applyRemote(node string, msg *Message) {
+	switch msg.Type {
+	case MsgJoin:
+		var p participant
+		if err := json.Unmarshal(msg.Data, &p); err == nil && p.SessionID != "" {
+			r.remote[p.SessionID] = &remoteMember{node: node, participant: p}
+		}
+	case MsgLeave:
+		var data leaveData
+		if err := json.Unmarshal(msg.Data, &data); err == nil {
+			delete(r.remote, data.SessionID)
+		}
+	case MsgMute:
+		var data muteData
+		if m := r.remote[msg.Session]; m != nil && json.Unmarshal(msg.Data, &data) == nil {
+			m.Muted = data.Muted
+		}
+	case MsgForceMute:
+		var data forceMuteData
+		if err := json.Unmarshal(msg.Data, &data); err == nil {
+			r.applyForceMute(data.UserID, data.Muted)
+		}
+	}
+}
+
+// 公布本实例的全部成员
+func (r *room) announce() {
+	if len(r.members) == 0 {
+		return
+	}
+	r.relay(clusterEvent{Type: clusterAnnounce, Participants: r.localRoster()}, nil)
+}
+
+// 以实例公布的成员为准，补发错过的 join 和 leave
+func (r *room) applyAnnounce(node string, list []participant) {
+	listed := make(map[string]bool, len(list))
+	for _, p := range list {
+		listed[p.SessionID] = true
+		if m := r.remote[p.SessionID]; m != nil {
+			m.participant = p
+			continue
+		}
+		r.remote[p.SessionID] = &remoteMember{node: node, participant: p}
+		if msg, err := newMessage(MsgJoin, p.UserID, p); err == nil {
+			r.deliver(msg)
+		}
+	}
+	for sid, m := range r.remote {
+		if m.node == node && !listed[sid] {
+			r.dropRemote(sid)
+		}
+	}
+}
+
+// 清理超时未公布成员的实例（通常是异常退出）上的成员
+func (r *room) expireNodes() {
+	for node, seen := range r.nodes {
+		if time.Since(seen) < clusterNodeTimeout {
+			continue
+		}
+		delete(r.nodes, node)
+		for sid, m := range r.remote {
+			if m.node == node {
+				r.dropRemote(sid)
+			}
+		}
+	}
+}
+
+func (r *room) dropRemote(sessionID string) {
+	m := r.remote[sessionID]
+	delete(r.remote, sessionID)
+	msg, err := newMessage(MsgLeave, m.UserID, leaveData{UserID: m.UserID, SessionID: sessionID})
+	if err == nil {
+		r.deliver(msg)
+	}
+}
+
+// 其他实例上是否有该访客ID或会话ID的成员
+func (r *room) hasRemote(id string) bool {
+	for sid, m := range r.remote {
+		if m.UserID == id || sid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// 直接发布到房间频道，用于本实例上没有该房间或需要所有实例执行的操作，返回收到消息的订阅数
+func (h *RoomHub) forward(roomID string, ev clusterEvent, data []byte) int {
+	ev.Node = nodeID
+	ev.data = data
+	payload, err := ev.encode()
+	if err != nil {
+		log.Printf("序列化实例间消息失败: %v", err)
+		return 0
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n, err := config.Broker.Publish(ctx, roomID, payload)
+	if err != nil {
+		log.Printf("房间 %s 发布消息失败: %v", roomID, err)
+	}
+	return n
+}
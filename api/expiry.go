@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+)
+
+// 房间到期调度：房间有成员加入时按 ExpireTime 设置定时器，到期时把房间标记为已结束并断开所有连接。
+// 定时器按房间ID索引，房间延长或结束时重新设置或取消，不需要轮询数据库，也不会阻塞其他房间。
+type expiryScheduler struct {
+	mu      sync.Mutex
+	timers  map[int64]*roomTimer
+	stopped bool // 服务关闭后不再设置定时器
+}
+
+type roomTimer struct {
+	joinCode string
+	expireAt time.Time
+	timer    *time.Timer
+}
+
+var expiry = &expiryScheduler{timers: make(map[int64]*roomTimer)}
+
+// 设置房间的到期时间，已有相同到期时间的定时器时不做任何事
+func (s *expiryScheduler) schedule(roomID int64, joinCode string, expireAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	if t, ok := s.timers[roomID]; ok {
+		if t.expireAt.Equal(expireAt) {
+			return
+		}
+		t.timer.Stop()
+	}
+
+	t := &roomTimer{joinCode: joinCode, expireAt: expireAt}
+	t.timer = time.AfterFunc(time.Until(expireAt), func() {
+		s.fire(roomID, t)
+	})
+	s.timers[roomID] = t
+}
+
+// 取消房间的定时器（房间被提前结束）
+func (s *expiryScheduler) cancel(roomID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.timers[roomID]; ok {
+		t.timer.Stop()
+		delete(s.timers, roomID)
+	}
+}
+
+// 取消所有定时器，服务关闭时调用
+func (s *expiryScheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stopped = true
+	for roomID, t := range s.timers {
+		t.timer.Stop()
+		delete(s.timers, roomID)
+	}
+}
+
+func (s *expiryScheduler) fire(roomID int64, t *roomTimer) {
+	s.mu.Lock()
+	if s.timers[roomID] != t {
+		// 已被重新设置或取消
+		s.mu.Unlock()
+		return
+	}
+	delete(s.timers, roomID)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	room, err := config.Store.Rooms.GetByID(ctx, roomID)
+	if err != nil {
+		log.Printf("查询到期房间失败: %v", err)
+	} else if room.Status == models.RoomOngoing {
+		// 其他实例可能刚刚延长了房间
+		if room.ExpireTime.After(time.Now()) {
+			s.schedule(roomID, t.joinCode, room.ExpireTime)
+			return
+		}
+		if err := config.Store.Rooms.UpdateStatus(ctx, roomID, models.RoomEnded); err != nil {
+			log.Printf("更新房间状态失败: %v", err)
+		}
+		room.Status = models.RoomEnded
+		broadcastRoomState(room)
+	} else if current, err := config.Store.Rooms.GetByJoinCode(ctx, t.joinCode); err == nil && current.ID != roomID {
+		// 房间已结束，加入码已被新房间使用
+		return
+	}
+
+	Hub.closeRoom(t.joinCode, "房间已过期")
+}
@@ -0,0 +1,395 @@
+package api
+
+import (
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+)
+
+// 房间注册表分片数，按邀请码哈希分片，减少不同房间之间的锁竞争
+const hubShards = 32
+
+// 每个房间广播队列的长度，队列满时发送方会等待，只影响同一房间
+const roomBroadcastQueue = 256
+
+// 在线房间注册表。
+//
+// 每个在线房间由一个独立的 goroutine（见 room.run）持有成员表和禁言表，加入、离开、广播都通过 channel
+// 交给该 goroutine 处理，不同房间之间互不阻塞；注册表本身只在查找、创建、删除房间时短暂加锁。
+// 注册表只包含本实例上有成员的房间，其他实例上的成员见 cluster.go。
+type RoomHub struct {
+	shards [hubShards]hubShard
+}
+
+type hubShard struct {
+	lock  sync.Mutex
+	rooms map[string]*room
+}
+
+var Hub = newRoomHub()
+
+func newRoomHub() *RoomHub {
+	h := &RoomHub{}
+	for i := range h.shards {
+		h.shards[i].rooms = make(map[string]*room)
+	}
+	return h
+}
+
+func (h *RoomHub) shard(code string) *hubShard {
+	f := fnv.New32a()
+	f.Write([]byte(code))
+	return &h.shards[f.Sum32()%hubShards]
+}
+
+// 查找在线房间，房间没人时返回 nil
+func (h *RoomHub) get(code string) *room {
+	s := h.shard(code)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rooms[code]
+}
+
+func (h *RoomHub) getOrCreate(code string) *room {
+	s := h.shard(code)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.rooms[code]
+	if !ok {
+		r = newRoom(code)
+		s.rooms[code] = r
+		go r.run(h)
+	}
+	return r
+}
+
+func (h *RoomHub) remove(r *room) {
+	s := h.shard(r.code)
+	s.lock.Lock()
+	if s.rooms[r.code] == r {
+		delete(s.rooms, r.code)
+	}
+	s.lock.Unlock()
+}
+
+// 房间 goroutine 持有的状态，members、forceMuted、remote、nodes 只能在 run 中访问
+type room struct {
+	code       string
+	members    map[string]*Client       // 按会话ID索引
+	forceMuted map[string]bool          // 按访客ID索引的被禁言成员，重连后仍然有效，房间清空时清除
+	remote     map[string]*remoteMember // 其他实例上的成员，按会话ID索引
+	nodes      map[string]time.Time     // 其他实例最近一次发来消息的时间
+	closed     bool                     // 为 true 时 run 处理完当前事件后退出
+	seq        int64                    // 最近一条广播控制消息的序号
+	history    []roomEvent              // 最近的广播控制消息，最多 config.ResumeBuffer 条
+
+	register   chan registerRequest
+	unregister chan leaveRequest
+	broadcast  chan roomBroadcast
+	ops        chan func(*room)
+	inbox      chan clusterEvent // 其他实例发来的消息
+	outbox     chan []byte       // 待发布到其他实例的消息，run 退出时关闭
+	done       chan struct{}     // run 退出时关闭
+}
+
+type registerRequest struct {
+	client *Client
+	reply  chan registerResult
+}
+
+type registerResult struct {
+	ok       bool    // 为 false 表示按 reject 策略被拒绝
+	replaced *Client // 按 replace 策略被替换的旧连接
+}
+
+type leaveRequest struct {
+	client *Client
+	reply  chan leaveResult
+}
+
+type leaveResult struct {
+	removed bool // 是否从房间中移除
+	empty   bool // 移除后房间是否已经没人
+}
+
+type roomBroadcast struct {
+	msg     outbound
+	control *Message // 不为空时作为控制消息编号、记录后发送，忽略 msg
+	exclude string   // 不发送给该会话，为空时发给所有人
+}
+
+// 已广播的控制消息
+type roomEvent struct {
+	seq     int64
+	frame   outbound
+	exclude string
+}
+
+func newRoom(code string) *room {
+	return &room{
+		code:       code,
+		members:    make(map[string]*Client),
+		forceMuted: make(map[string]bool),
+		remote:     make(map[string]*remoteMember),
+		nodes:      make(map[string]time.Time),
+		register:   make(chan registerRequest),
+		unregister: make(chan leaveRequest),
+		broadcast:  make(chan roomBroadcast, roomBroadcastQueue),
+		ops:        make(chan func(*room)),
+		inbox:      make(chan clusterEvent, clusterQueue),
+		outbox:     make(chan []byte, clusterQueue),
+		done:       make(chan struct{}),
+	}
+}
+
+func (r *room) run(h *RoomHub) {
+	leaveCluster := r.joinCluster()
+	ticker := time.NewTicker(clusterAnnounceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case req := <-r.register:
+			req.reply <- r.admit(req.client)
+		case req := <-r.unregister:
+			req.reply <- r.leave(req.client)
+		case b := <-r.broadcast:
+			if b.control != nil {
+				r.publishLocal(b.control, b.exclude)
+			} else {
+				r.fanout(b.msg, b.exclude)
+				r.relayFrame(b.msg)
+			}
+		case fn := <-r.ops:
+			fn(r)
+		case ev := <-r.inbox:
+			r.handleRemote(ev)
+		case <-ticker.C:
+			r.announce()
+			r.expireNodes()
+		}
+
+		if r.closed {
+			// 先从注册表中删除再关闭 done，之后的加入请求会创建新的房间
+			h.remove(r)
+			close(r.done)
+			leaveCluster()
+			return
+		}
+	}
+}
+
+// 按 config.SessionPolicy 处理同一访客的已有连接后加入房间
+func (r *room) admit(c *Client) registerResult {
+	var old *Client
+	if config.SessionPolicy != config.SessionMulti {
+		old = r.memberByUser(c.userID)
+	}
+	if old != nil {
+		if config.SessionPolicy == config.SessionReject {
+			return registerResult{}
+		}
+		delete(r.members, old.sessionID)
+		old.evicted.Store(true)
+		// 等待恢复的旧会话到期后不能再释放资源，录音的 stream 已由新连接沿用
+		old.stopGrace()
+		r.announceLeave(old)
+	}
+	r.add(c)
+	return registerResult{ok: true, replaced: old}
+}
+
+func (r *room) leave(c *Client) leaveResult {
+	if r.members[c.sessionID] != c {
+		return leaveResult{}
+	}
+	c.stopGrace()
+	delete(r.members, c.sessionID)
+	// 本实例上没人时也要通知其他实例
+	r.announceLeave(c)
+	if len(r.members) == 0 {
+		r.closed = true
+		return leaveResult{removed: true, empty: true}
+	}
+	return leaveResult{removed: true}
+}
+
+// 访客的任意一条连接，不在房间时返回 nil
+func (r *room) memberByUser(userID string) *Client {
+	for _, peer := range r.members {
+		if peer.userID == userID {
+			return peer
+		}
+	}
+	return nil
+}
+
+// 在房间 goroutine 中执行 fn 并等待其完成，房间已关闭时返回 false。
+// fn 中不能再同步调用同一房间的其他操作。
+func (r *room) do(fn func(*room)) bool {
+	finished := make(chan struct{})
+	select {
+	case r.ops <- func(r *room) { fn(r); close(finished) }:
+		<-finished
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// 在房间 goroutine 中执行 fn，房间不在线时返回 false
+func (h *RoomHub) do(code string, fn func(*room)) bool {
+	r := h.get(code)
+	if r == nil {
+		return false
+	}
+	return r.do(fn)
+}
+
+// 将客户端加入房间，房间 goroutine 恰好退出时重新创建。
+// 返回被替换的旧连接，由调用方关闭；按 reject 策略被拒绝时 ok 为 false。
+func (h *RoomHub) join(c *Client) (replaced *Client, ok bool) {
+	reply := make(chan registerResult, 1)
+	for {
+		r := h.getOrCreate(c.roomID)
+		c.room = r
+		select {
+		case r.register <- registerRequest{client: c, reply: reply}:
+			res := <-reply
+			return res.replaced, res.ok
+		case <-r.done:
+		}
+	}
+}
+
+// 将客户端移出房间
+func (h *RoomHub) leave(c *Client) leaveResult {
+	if c.room == nil {
+		return leaveResult{}
+	}
+	reply := make(chan leaveResult, 1)
+	select {
+	case c.room.unregister <- leaveRequest{client: c, reply: reply}:
+		return <-reply
+	case <-c.room.done:
+		return leaveResult{}
+	}
+}
+
+// 广播一帧到房间，exclude 为空时发给所有成员
+func (r *room) send(msg outbound, exclude string) {
+	select {
+	case r.broadcast <- roomBroadcast{msg: msg, exclude: exclude}:
+	case <-r.done:
+	}
+}
+
+// 广播控制消息到房间，消息会被编号并记录，调用后不能再修改 msg
+func (r *room) publish(msg *Message, exclude string) {
+	select {
+	case r.broadcast <- roomBroadcast{control: msg, exclude: exclude}:
+	case <-r.done:
+	}
+}
+
+// 编号、记录并广播控制消息，同时转发到其他实例，只在房间 goroutine 中调用
+func (r *room) publishLocal(msg *Message, exclude string) {
+	frame, ok := r.record(msg, exclude)
+	if !ok {
+		return
+	}
+	r.fanout(frame, exclude)
+	r.relayFrame(frame)
+}
+
+// 编号、记录并广播其他实例发来的控制消息，不再转发，只在房间 goroutine 中调用
+func (r *room) deliver(msg *Message) {
+	if frame, ok := r.record(msg, ""); ok {
+		r.fanout(frame, "")
+	}
+}
+
+// 为控制消息编号并记录到补发缓冲区
+func (r *room) record(msg *Message, exclude string) (outbound, bool) {
+	r.seq++
+	msg.Seq = r.seq
+	frame, err := msg.frame()
+	if err != nil {
+		log.Printf("序列化消息失败: %v", err)
+		return outbound{}, false
+	}
+	// 补发时也会复用，总是预先分帧（需要压缩时）
+	frame = frame.prepare()
+	if config.ResumeBuffer > 0 {
+		r.history = append(r.history, roomEvent{seq: r.seq, frame: frame, exclude: exclude})
+		if len(r.history) > config.ResumeBuffer {
+			r.history = r.history[len(r.history)-config.ResumeBuffer:]
+		}
+	}
+	return frame, true
+}
+
+func (r *room) fanout(msg outbound, exclude string) {
+	recipients := len(r.members)
+	if _, ok := r.members[exclude]; ok {
+		recipients--
+	}
+	// 同一帧发给多个成员时只压缩一次
+	if recipients > 1 {
+		msg = msg.prepare()
+	}
+	for sid, peer := range r.members {
+		if sid != exclude {
+			peer.enqueue(msg)
+		}
+	}
+}
+
+// 广播控制消息给房间内所有成员，房间不在本实例上时直接转发给其他实例。
+// 返回房间是否在线（在任一实例上）。
+func (h *RoomHub) broadcast(roomID string, msg *Message) bool {
+	if r := h.get(roomID); r != nil {
+		r.publish(msg, "")
+		return true
+	}
+	frame, err := msg.frame()
+	if err != nil {
+		log.Printf("序列化消息失败: %v", err)
+		return false
+	}
+	return h.forward(roomID, clusterEvent{Type: clusterFrame, Kind: frame.kind}, frame.data) > 0
+}
+
+// 房间内指定访客的任意一条连接，不在线时返回 nil
+func (h *RoomHub) member(roomID, userID string) *Client {
+	var peer *Client
+	h.do(roomID, func(r *room) {
+		peer = r.memberByUser(userID)
+	})
+	return peer
+}
+
+// 关闭房间：移除所有实例上的成员并结束录音
+func (h *RoomHub) closeRoom(roomID, reason string) {
+	h.forward(roomID, clusterEvent{Type: clusterClose, Reason: reason}, nil)
+	h.do(roomID, func(r *room) {
+		r.evict(reason)
+	})
+	go stopRecording(roomID)
+}
+
+// 断开本实例上的所有成员并关闭房间，只在房间 goroutine 中调用
+func (r *room) evict(reason string) {
+	for _, client := range r.members {
+		client.evicted.Store(true)
+		client.stopGrace()
+		go client.cleanupWith(websocket.CloseNormalClosure, reason)
+	}
+	r.closed = true
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"talkFlow/broker"
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+)
+
+func TestMain(m *testing.M) {
+	config.Broker = broker.NewMemory()
+	config.Store = store.NewMemory()
+	config.SessionPolicy = config.SessionMulti
+	config.SlowConsumerPolicy = config.SlowDropOldest
+	config.ResumeBuffer = 200
+	os.Exit(m.Run())
+}
+
+var testSessions atomic.Int64
+
+// 不带 WebSocket 连接的客户端，只使用发送队列
+func newTestClient(roomID, userID string) *Client {
+	return &Client{
+		roomID:    roomID,
+		userID:    userID,
+		sessionID: fmt.Sprintf("s%d", testSessions.Add(1)),
+		stream:    userID,
+		name:      userID,
+		joinedAt:  time.Now(),
+		media:     models.MediaMesh,
+		send:      make(chan outbound, 256),
+		audio:     make(chan outbound, 256),
+		done:      make(chan struct{}),
+	}
+}
+
+// 代替 writePump 不断取出发送队列，连接关闭时退出
+func drain(c *Client) {
+	go func() {
+		for {
+			select {
+			case <-c.send:
+			case <-c.audio:
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+func roomCount(h *RoomHub) int {
+	n := 0
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.lock.Lock()
+		n += len(s.rooms)
+		s.lock.Unlock()
+	}
+	return n
+}
+
+// 最后一个成员离开后房间 goroutine 异步退出，等待注册表清空
+func waitForEmptyHub(t testing.TB, h *RoomHub) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for roomCount(h) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("注册表中仍有 %d 个房间", roomCount(h))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 客户端是否是注册表中当前在线房间的成员
+func isLiveMember(h *RoomHub, c *Client) bool {
+	if c.room == nil || h.get(c.roomID) != c.room {
+		return false
+	}
+	member := false
+	if !c.room.do(func(r *room) { member = r.members[c.sessionID] == c }) {
+		return false
+	}
+	return member
+}
+
+func TestHubConcurrentJoinLeave(t *testing.T) {
+	h := newRoomHub()
+	const rooms, perRoom, rounds = 100, 5, 10
+
+	var wg sync.WaitGroup
+	for i := 0; i < rooms*perRoom; i++ {
+		c := newTestClient(fmt.Sprintf("JL%04d", i%rooms), fmt.Sprintf("u%d", i))
+		drain(c)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(c.done)
+			for n := 0; n < rounds; n++ {
+				if _, ok := h.join(c); !ok {
+					t.Errorf("%s 加入房间 %s 被拒绝", c.userID, c.roomID)
+					return
+				}
+				if !h.leave(c).removed {
+					t.Errorf("%s 没有从房间 %s 中移除", c.userID, c.roomID)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	waitForEmptyHub(t, h)
+}
+
+// 最后一个成员离开（房间 goroutine 退出）的同时有新成员加入，新成员必须进入仍在线的房间
+func TestHubTeardownWhileJoining(t *testing.T) {
+	h := newRoomHub()
+
+	for i := 0; i < 300; i++ {
+		code := fmt.Sprintf("TD%04d", i%20)
+		first := newTestClient(code, "first")
+		if _, ok := h.join(first); !ok {
+			t.Fatal("加入房间被拒绝")
+		}
+		late := newTestClient(code, "late")
+		drain(late)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			h.leave(first)
+		}()
+		go func() {
+			defer wg.Done()
+			h.join(late)
+		}()
+		wg.Wait()
+
+		if !isLiveMember(h, late) {
+			t.Fatalf("第 %d 轮: 新成员加入了已经关闭的房间", i)
+		}
+		h.leave(late)
+		close(late.done)
+	}
+	waitForEmptyHub(t, h)
+}
+
+// 房主关闭房间的同时有成员加入：要么被移出，要么进入新创建的房间
+func TestHubCloseRoomWhileJoining(t *testing.T) {
+	const code = "CLOSE1"
+	for round := 0; round < 20; round++ {
+		var clients []*Client
+		for i := 0; i < 3; i++ {
+			c := newTestClient(code, fmt.Sprintf("early%d", i))
+			drain(c)
+			Hub.join(c)
+			clients = append(clients, c)
+		}
+
+		var wg sync.WaitGroup
+		var lateMu sync.Mutex
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := newTestClient(code, fmt.Sprintf("late%d", i))
+				drain(c)
+				Hub.join(c)
+				lateMu.Lock()
+				clients = append(clients, c)
+				lateMu.Unlock()
+			}(i)
+		}
+		Hub.closeRoom(code, "测试")
+		wg.Wait()
+
+		for _, c := range clients {
+			if c.evicted.Load() {
+				select {
+				case <-c.done:
+				case <-time.After(5 * time.Second):
+					t.Fatalf("被移出的 %s 没有断开", c.userID)
+				}
+				continue
+			}
+			if !isLiveMember(Hub, c) {
+				t.Fatalf("第 %d 轮: %s 既没有被移出也不在在线房间中", round, c.userID)
+			}
+		}
+		for _, c := range clients {
+			c.cleanupWith(websocket.CloseNormalClosure, "")
+		}
+	}
+	waitForEmptyHub(t, Hub)
+}
+
+const (
+	hubBenchRooms   = 500
+	hubBenchPerRoom = 8
+)
+
+func benchRoomCodes() []string {
+	codes := make([]string, hubBenchRooms)
+	for i := range codes {
+		codes[i] = fmt.Sprintf("B%05d", i)
+	}
+	return codes
+}
+
+// 每个房间放一个常驻成员，避免房间在各轮之间被销毁
+func benchAnchors(b *testing.B, h *RoomHub, codes []string) {
+	var anchors []*Client
+	for _, code := range codes {
+		c := newTestClient(code, "anchor")
+		drain(c)
+		h.join(c)
+		anchors = append(anchors, c)
+	}
+	b.Cleanup(func() {
+		for _, c := range anchors {
+			h.leave(c)
+			close(c.done)
+		}
+	})
+}
+
+// 每轮给每个房间创建 hubBenchPerRoom 个客户端
+func benchClients(codes []string, n int) []*Client {
+	clients := make([]*Client, n)
+	for i := range clients {
+		clients[i] = newTestClient(codes[i%len(codes)], fmt.Sprintf("u%d", i))
+		drain(clients[i])
+	}
+	return clients
+}
+
+// 多个 goroutine 并发对 clients 执行 fn
+func benchParallel(clients []*Client, fn func(c *Client)) {
+	workers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(clients); i += workers {
+				fn(clients[i])
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func releaseClients(h *RoomHub, clients []*Client, leave bool) {
+	for _, c := range clients {
+		if leave {
+			h.leave(c)
+		}
+		close(c.done)
+	}
+}
+
+func BenchmarkHubRegister(b *testing.B) {
+	h := newRoomHub()
+	codes := benchRoomCodes()
+	benchAnchors(b, h, codes)
+
+	b.ResetTimer()
+	for done := 0; done < b.N; {
+		b.StopTimer()
+		clients := benchClients(codes, min(b.N-done, hubBenchRooms*hubBenchPerRoom))
+		b.StartTimer()
+
+		benchParallel(clients, func(c *Client) { h.join(c) })
+
+		b.StopTimer()
+		releaseClients(h, clients, true)
+		done += len(clients)
+	}
+}
+
+func BenchmarkHubUnregister(b *testing.B) {
+	h := newRoomHub()
+	codes := benchRoomCodes()
+	benchAnchors(b, h, codes)
+
+	b.ResetTimer()
+	for done := 0; done < b.N; {
+		b.StopTimer()
+		clients := benchClients(codes, min(b.N-done, hubBenchRooms*hubBenchPerRoom))
+		benchParallel(clients, func(c *Client) { h.join(c) })
+		b.StartTimer()
+
+		benchParallel(clients, func(c *Client) { h.leave(c) })
+
+		b.StopTimer()
+		releaseClients(h, clients, false)
+		done += len(clients)
+	}
+}
+
+func BenchmarkHubBroadcast(b *testing.B) {
+	h := newRoomHub()
+	codes := benchRoomCodes()
+	benchAnchors(b, h, codes)
+	clients := benchClients(codes, hubBenchRooms*(hubBenchPerRoom-1))
+	benchParallel(clients, func(c *Client) { h.join(c) })
+	b.Cleanup(func() { releaseClients(h, clients, true) })
+
+	rooms := make([]*room, len(codes))
+	for i, code := range codes {
+		rooms[i] = h.get(code)
+	}
+
+	b.Run("audio", func(b *testing.B) {
+		frame := outbound{kind: websocket.BinaryMessage, data: make([]byte, 160)}
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				rooms[next.Add(1)%hubBenchRooms].send(frame, "")
+			}
+		})
+	})
+	b.Run("control", func(b *testing.B) {
+		var next atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				msg, _ := newMessage(MsgChat, "u0", chatData{Text: "hello"})
+				rooms[next.Add(1)%hubBenchRooms].publish(msg, "")
+			}
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/utils"
+)
+
+// 加入码防枚举：房间不存在的请求按IP和访客ID记录到 join_failures，
+// 统计窗口内失败过多时直接拒绝；失败达到一定次数后，加入房间前还需要完成一次工作量证明。
+
+// 统计窗口内该IP和访客ID中较多的失败次数，达到上限时同时返回需要等待的时长
+func joinMisses(ctx context.Context, ip, visitorID string) (int, time.Duration, error) {
+	since := time.Now().Add(-config.JoinFailureWindow)
+	byIP, oldestIP, err := config.Store.JoinFailures.CountByIP(ctx, ip, since)
+	if err != nil {
+		return 0, 0, err
+	}
+	byVisitor, oldestVisitor, err := config.Store.JoinFailures.CountByVisitor(ctx, visitorID, since)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 最早的一次失败移出窗口后次数才会低于上限
+	var wait time.Duration
+	if config.JoinMaxFailures > 0 {
+		if byIP >= config.JoinMaxFailures {
+			wait = max(wait, time.Until(oldestIP.Add(config.JoinFailureWindow)))
+		}
+		if byVisitor >= config.JoinMaxFailures {
+			wait = max(wait, time.Until(oldestVisitor.Add(config.JoinFailureWindow)))
+		}
+	}
+	return max(byIP, byVisitor), wait, nil
+}
+
+// 检查失败次数，达到上限时回复 429 并返回 false；visitorID 未知时传空字符串
+func checkJoinLimit(ctx context.Context, c *gin.Context, visitorID string) (int, bool) {
+	misses, wait, err := joinMisses(ctx, c.ClientIP(), visitorID)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50002, "error": "查询房间状态失败"})
+		log.Println("查询加入码失败记录失败:", err)
+		return 0, false
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(429, gin.H{"code": 42902, "error": "尝试次数过多，请稍后再试", "retry_after": seconds})
+		return misses, false
+	}
+	return misses, true
+}
+
+// 失败次数达到 JoinChallengeAfter 时校验工作量证明，未通过时回复 429 并附上新的题目
+func checkJoinChallenge(ctx context.Context, c *gin.Context, misses int, challenge, solution string) bool {
+	if config.JoinChallengeAfter == 0 || misses < config.JoinChallengeAfter {
+		return true
+	}
+	if challenge != "" {
+		err := utils.VerifyChallenge(ctx, challenge, solution, c.ClientIP())
+		if err == nil {
+			return true
+		}
+		if err != utils.ErrChallengeInvalid && err != utils.ErrChallengeUsed {
+			c.JSON(500, gin.H{"code": 50002, "error": "查询房间状态失败"})
+			log.Println("校验工作量证明失败:", err)
+			return false
+		}
+	}
+
+	token, exp, err := utils.IssueChallenge(c.ClientIP(), config.JoinPowDifficulty)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50004, "error": "生成验证题目失败"})
+		log.Println("生成工作量证明题目失败:", err)
+		return false
+	}
+	c.JSON(429, gin.H{
+		"code":       42903,
+		"error":      "请先完成验证",
+		"challenge":  token,
+		"difficulty": config.JoinPowDifficulty,
+		"expires_in": int(time.Until(exp).Seconds()),
+	})
+	return false
+}
+
+// 记录一次加入码校验失败
+func recordJoinMiss(ctx context.Context, c *gin.Context, source, joinCode, visitorID string) {
+	err := config.Store.JoinFailures.Create(ctx, &models.JoinFailure{
+		JoinCode:  joinCode,
+		VisitorID: visitorID,
+		IP:        c.ClientIP(),
+		Source:    source,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		log.Println("写入加入码失败记录出错:", err)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/utils"
+)
+
+// 服务端 → 客户端：房间状态变化（延长、锁定、结束）
+const MsgRoom = "room"
+
+const maxExtendMinutes = 24 * 60 // 单次延长的最大分钟数
+
+type roomStateData struct {
+	ExpireTime time.Time `json:"expire_time"`
+	Locked     bool      `json:"locked"`
+	Ended      bool      `json:"ended"`
+}
+
+func broadcastRoomState(room *models.Room) {
+	msg, err := newMessage(MsgRoom, "", roomStateData{
+		ExpireTime: room.ExpireTime,
+		Locked:     room.Locked,
+		Ended:      room.Status == models.RoomEnded,
+	})
+	if err != nil {
+		return
+	}
+	Hub.broadcast(room.JoinCode, msg)
+}
+
+// 加载进行中的房间（仅房主），房间已结束时已写好响应
+func loadOngoingHostRoom(c *gin.Context) (*models.Room, bool) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return nil, false
+	}
+	if !room.IsOngoing() {
+		c.JSON(400, gin.H{"code": 40002, "error": "房间已结束"})
+		return nil, false
+	}
+	return room, true
+}
+
+// 立即结束房间并断开所有成员（仅房主）
+func EndRoom(c *gin.Context) {
+	room, ok := loadOngoingHostRoom(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := config.Store.Rooms.UpdateStatus(ctx, room.ID, models.RoomEnded); err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "结束房间失败", "eventID": logID})
+		return
+	}
+	room.Status = models.RoomEnded
+	expiry.cancel(room.ID)
+
+	broadcastRoomState(room)
+	Hub.closeRoom(room.JoinCode, "房间已被房主结束")
+
+	c.JSON(200, gin.H{"code": 20000, "message": "房间已结束"})
+}
+
+// 延长房间有效期（仅房主）
+func ExtendRoom(c *gin.Context) {
+	var req struct {
+		Minutes int `json:"minutes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Minutes <= 0 || req.Minutes > maxExtendMinutes {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	room, ok := loadOngoingHostRoom(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	expireTime := room.ExpireTime.Add(time.Duration(req.Minutes) * time.Minute)
+	if err := config.Store.Rooms.UpdateExpireTime(ctx, room.ID, expireTime); err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "延长房间失败", "eventID": logID})
+		return
+	}
+	room.ExpireTime = expireTime
+	expiry.schedule(room.ID, room.JoinCode, expireTime)
+
+	broadcastRoomState(room)
+	c.JSON(200, gin.H{"code": 20000, "message": "房间已延长", "expire_time": expireTime})
+}
+
+// 锁定或解锁房间（仅房主），锁定后只有房主可以加入
+func LockRoom(c *gin.Context) {
+	var req struct {
+		Locked bool `json:"locked"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	room, ok := loadOngoingHostRoom(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := config.Store.Rooms.SetLocked(ctx, room.ID, req.Locked); err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "锁定房间失败", "eventID": logID})
+		return
+	}
+	room.Locked = req.Locked
+
+	broadcastRoomState(room)
+	c.JSON(200, gin.H{"code": 20000, "message": "操作成功", "locked": room.Locked})
+}
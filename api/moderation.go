@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+)
+
+// 房主管理消息，客户端 → 服务端需要持有房主凭证
+const (
+	MsgForceMute = "force_mute" // 禁言或解除禁言成员，服务端广播给整个房间
+	MsgKick      = "kick"       // 将成员移出房间，被移出的成员断开前会收到该消息
+	MsgBan       = "ban"        // 封禁成员并将其移出房间，房间结束前无法再加入
+)
+
+const maxReasonLength = 100 // 移出/封禁原因最大字符数
+
+type forceMuteData struct {
+	UserID string `json:"user_id"`
+	Muted  bool   `json:"muted"`
+}
+
+type kickData struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type banData struct {
+	UserID string `json:"user_id"`
+	Reason string `json:"reason,omitempty"`
+	IP     bool   `json:"ip,omitempty"` // 同时封禁该成员当前的IP
+}
+
+func init() {
+	registerHandler(MsgForceMute, handleForceMute)
+	registerHandler(MsgKick, handleKick)
+	registerHandler(MsgBan, handleBan)
+}
+
+// 房主管理消息的公共校验，失败时已回复错误
+func moderationTarget(c *Client, userID string) bool {
+	if !c.host {
+		c.sendError(40302, "只有房主可以执行该操作")
+		return false
+	}
+	if userID == "" {
+		c.sendError(40001, "消息格式错误")
+		return false
+	}
+	if userID == c.userID {
+		c.sendError(40009, "不能对自己执行该操作")
+		return false
+	}
+	return true
+}
+
+func handleForceMute(c *Client, msg *Message) {
+	var data forceMuteData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	if !moderationTarget(c, data.UserID) {
+		return
+	}
+	if !Hub.forceMute(c.roomID, data.UserID, data.Muted, c.userID) {
+		c.sendError(40404, "目标成员不在房间内")
+	}
+}
+
+func handleKick(c *Client, msg *Message) {
+	var data kickData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	if !moderationTarget(c, data.UserID) {
+		return
+	}
+	if utf8.RuneCountInString(data.Reason) > maxReasonLength {
+		c.sendError(40004, "消息过长")
+		return
+	}
+	if Hub.kick(c.roomID, data.UserID, "", data.Reason, c.userID) == 0 {
+		c.sendError(40404, "目标成员不在房间内")
+	}
+}
+
+func handleBan(c *Client, msg *Message) {
+	var data banData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	if !moderationTarget(c, data.UserID) {
+		return
+	}
+	if utf8.RuneCountInString(data.Reason) > maxReasonLength {
+		c.sendError(40004, "消息过长")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := banVisitor(ctx, c.roomDBID, c.roomID, data.UserID, data.IP, data.Reason, c.userID); err != nil {
+		c.sendError(50002, "封禁失败")
+		log.Printf("封禁成员失败: %v", err)
+	}
+}
+
+// 设置成员的禁言状态并广播，成员不在房间时返回 false。
+// 中转模式和 SFU 模式下服务端不再转发其音频；P2P 直连时只能由客户端根据广播自行处理。
+// 其他实例根据广播更新各自成员的状态；房间不在本实例上时无法确认成员是否在线，只要房间在线就视为成功。
+func (h *RoomHub) forceMute(roomID, userID string, muted bool, by string) bool {
+	found := false
+	online := h.do(roomID, func(r *room) {
+		if r.memberByUser(userID) == nil && !r.hasRemote(userID) {
+			return
+		}
+		found = true
+		r.applyForceMute(userID, muted)
+	})
+	if online && !found {
+		return false
+	}
+
+	msg, err := newMessage(MsgForceMute, by, forceMuteData{UserID: userID, Muted: muted})
+	if err != nil {
+		log.Printf("序列化 force_mute 消息失败: %v", err)
+		return found
+	}
+	return h.broadcast(roomID, msg)
+}
+
+// 更新本实例上访客的禁言状态，只在房间 goroutine 中调用
+func (r *room) applyForceMute(userID string, muted bool) {
+	if muted {
+		r.forceMuted[userID] = true
+	} else {
+		delete(r.forceMuted, userID)
+	}
+	for _, peer := range r.members {
+		if peer.userID != userID {
+			continue
+		}
+		peer.forceMuted.Store(muted)
+		if peer.media == models.MediaSFU {
+			// 尚未加入 SFU 时由 handleSFUJoin 补上
+			sfuManager.SetMuted(r.code, peer.sessionID, muted)
+		}
+	}
+	for _, m := range r.remote {
+		if m.UserID == userID {
+			m.ForceMuted = muted
+		}
+	}
+}
+
+// 将访客ID为 userID 或IP为 ip 的成员移出房间（空字符串不参与匹配），返回移出的人数。
+// 其他实例上的成员按访客ID计入；房间不在本实例上时无法得知人数，只要房间在线就按 1 人计。
+func (h *RoomHub) kick(roomID, userID, ip, reason, by string) int {
+	var targets []*Client
+	remote := 0
+	online := h.do(roomID, func(r *room) {
+		targets = r.kickTargets(userID, ip)
+		for _, m := range r.remote {
+			if userID != "" && m.UserID == userID {
+				remote++
+			}
+		}
+	})
+	// IP 只有成员所在的实例知道，总是转发
+	n := h.forward(roomID, clusterEvent{Type: clusterKick, UserID: userID, IP: ip, Reason: reason, By: by}, nil)
+	if !online && n > 0 {
+		remote = 1
+	}
+
+	kickClients(targets, reason, by)
+	return len(targets) + remote
+}
+
+// 本实例上要移出的成员，只在房间 goroutine 中调用。
+// 立即标记为已移除，之后断开前的这段时间里等待恢复的会话不能再被接替，见 room.resume
+func (r *room) kickTargets(userID, ip string) []*Client {
+	var targets []*Client
+	for _, peer := range r.members {
+		if (userID != "" && peer.userID == userID) || (ip != "" && peer.ip == ip && !peer.host) {
+			peer.evicted.Store(true)
+			peer.stopGrace()
+			targets = append(targets, peer)
+		}
+	}
+	return targets
+}
+
+// 通知并断开被移出的成员
+func kickClients(targets []*Client, reason, by string) {
+	for _, target := range targets {
+		msg, _ := newMessage(MsgKick, by, kickData{UserID: target.userID, Reason: reason})
+		target.sendMessage(msg)
+		target.cleanupWith(websocket.ClosePolicyViolation, "已被房主移出房间")
+	}
+}
+
+// 封禁访客并将其移出房间；banIP 为 true 且成员在线时同时封禁其当前IP
+func banVisitor(ctx context.Context, roomID int64, joinCode, visitorID string, banIP bool, reason, by string) (*models.RoomBan, error) {
+	ban := &models.RoomBan{
+		RoomID:    roomID,
+		VisitorID: visitorID,
+		Reason:    reason,
+		BannedBy:  by,
+		CreatedAt: time.Now(),
+	}
+	if banIP {
+		if target := Hub.member(joinCode, visitorID); target != nil {
+			ban.IP = target.ip
+		}
+	}
+
+	if err := config.Store.Bans.Create(ctx, ban); err != nil {
+		return nil, err
+	}
+	Hub.kick(joinCode, visitorID, ban.IP, reason, by)
+	return ban, nil
+}
+
+// 禁言或解除禁言成员（仅房主）
+func MuteParticipant(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Muted bool `json:"muted"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	if !Hub.forceMute(room.JoinCode, c.Param("user_id"), req.Muted, c.GetString("username")) {
+		c.JSON(404, gin.H{"code": 40405, "error": "成员不在房间内"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "操作成功"})
+}
+
+// 将成员移出房间（仅房主）
+func KickParticipant(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	// 请求体可选
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+			return
+		}
+	}
+	if utf8.RuneCountInString(req.Reason) > maxReasonLength {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	if Hub.kick(room.JoinCode, c.Param("user_id"), "", req.Reason, c.GetString("username")) == 0 {
+		c.JSON(404, gin.H{"code": 40405, "error": "成员不在房间内"})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "已移出房间"})
+}
+
+// 封禁访客（仅房主），访客不在线时同样生效
+func BanParticipant(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		VisitorID string `json:"visitor_id" binding:"required"`
+		BanIP     bool   `json:"ban_ip"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || utf8.RuneCountInString(req.Reason) > maxReasonLength {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ban, err := banVisitor(ctx, room.ID, room.JoinCode, req.VisitorID, req.BanIP, req.Reason, c.GetString("username"))
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "封禁失败", "eventID": logID})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "已封禁", "ban": ban})
+}
+
+// 列出房间的封禁记录（仅房主）
+func ListBans(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bans, err := config.Store.Bans.ListByRoom(ctx, room.ID)
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "查询封禁记录失败", "eventID": logID})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "bans": bans})
+}
+
+// 解除封禁（仅房主）
+func DeleteBan(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = config.Store.Bans.Delete(ctx, room.ID, id)
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40406, "error": "封禁记录不存在"})
+		return
+	}
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "解除封禁失败", "eventID": logID})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "已解除封禁"})
+}
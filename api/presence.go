@@ -0,0 +1,98 @@
+package api
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// 房间成员信息，用于名单快照和 join 事件
+type participant struct {
+	UserID     string    `json:"user_id"`
+	SessionID  string    `json:"session_id,omitempty"` // 只在 WebSocket 内下发
+	Name       string    `json:"name"`
+	Host       bool      `json:"host"`
+	Muted      bool      `json:"muted"`
+	ForceMuted bool      `json:"force_muted"` // 被房主禁言
+	JoinedAt   time.Time `json:"joined_at"`
+}
+
+type rosterData struct {
+	Participants []participant `json:"participants"`
+}
+
+type leaveData struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+func (c *Client) participant() participant {
+	return participant{
+		UserID:     c.userID,
+		SessionID:  c.sessionID,
+		Name:       c.name,
+		Host:       c.host,
+		Muted:      c.muted.Load(),
+		ForceMuted: c.forceMuted.Load(),
+		JoinedAt:   c.joinedAt,
+	}
+}
+
+// 包括其他实例上的成员，按加入时间排序，只在房间 goroutine 中调用
+func (r *room) roster() []participant {
+	list := r.localRoster()
+	for _, m := range r.remote {
+		list = append(list, m.participant)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].JoinedAt.Before(list[j].JoinedAt)
+	})
+	return list
+}
+
+// 本实例上的成员，只在房间 goroutine 中调用
+func (r *room) localRoster() []participant {
+	list := make([]participant, 0, len(r.members)+len(r.remote))
+	for _, peer := range r.members {
+		list = append(list, peer.participant())
+	}
+	return list
+}
+
+// 房间当前在线成员快照
+func (h *RoomHub) roster(roomID string) []participant {
+	list := []participant{}
+	h.do(roomID, func(r *room) {
+		list = r.roster()
+	})
+	return list
+}
+
+// 将客户端加入房间：给新成员发送名单快照，并通知其他成员，只在房间 goroutine 中调用
+func (r *room) add(c *Client) {
+	r.members[c.sessionID] = c
+	c.forceMuted.Store(r.forceMuted[c.userID])
+
+	joinMsg, err := newMessage(MsgJoin, c.userID, c.participant())
+	if err != nil {
+		log.Printf("序列化 join 消息失败: %v", err)
+		return
+	}
+	r.publishLocal(joinMsg, c.sessionID)
+	r.sendRoster(c)
+}
+
+// 给成员发送名单快照，seq 为快照时最近一条广播的序号，只在房间 goroutine 中调用
+func (r *room) sendRoster(c *Client) {
+	rosterMsg, _ := newMessage(MsgRoster, "", rosterData{Participants: r.roster()})
+	rosterMsg.Seq = r.seq
+	if frame, err := rosterMsg.frame(); err == nil {
+		c.enqueue(frame)
+	}
+}
+
+// 通知房间其他成员有人离开，只在房间 goroutine 中调用
+func (r *room) announceLeave(c *Client) {
+	msg, _ := newMessage(MsgLeave, c.userID, leaveData{UserID: c.userID, SessionID: c.sessionID})
+	r.publishLocal(msg, "")
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"talkFlow/config"
-	"talkFlow/models"
 	"talkFlow/utils"
 	"time"
 
@@ -22,14 +21,7 @@ func GetProfile(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.Register
-	query := `SELECT id, username, email, avatar FROM register WHERE username = ?`
-	err := config.DB.QueryRowContext(ctx, query, username.(string)).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.Avatar,
-	)
+	user, err := config.Store.Users.GetByUsername(ctx, username.(string))
 	if err != nil {
 		logID, _ := utils.Logger(username.(string), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
 		c.JSON(500, gin.H{
@@ -42,9 +34,12 @@ func GetProfile(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"code":     20000,
-		"username": user.Username,
-		"email":    user.Email,
-		"avatar":   user.Avatar,
+		"code":           20000,
+		"username":       user.Username,
+		"email":          user.Email,
+		"avatar":         user.Avatar,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"mfa_enabled":    user.MFAEnabled,
 	})
 }
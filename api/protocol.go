@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+)
+
+// WebSocket 协议：
+//   - 文本帧承载 JSON 控制消息（Message），按 type 分发
+//   - 二进制帧承载音频数据，原样转发给同房间其他成员
+const ProtocolVersion = 1
+
+// 控制消息类型
+const (
+	MsgHello  = "hello"  // 服务端 → 客户端：连接建立后下发协议版本和自身ID
+	MsgJoin   = "join"   // 有成员加入房间
+	MsgRoster = "roster" // 服务端 → 客户端：加入后下发当前成员名单
+	MsgLeave  = "leave"  // 有成员离开房间；客户端发送表示主动离开
+	MsgMute   = "mute"   // 成员静音状态变化
+	MsgChat   = "chat"   // 文字消息
+	MsgPing   = "ping"
+	MsgPong   = "pong"
+	MsgError  = "error" // 服务端 → 客户端：处理消息出错
+
+	MsgReconnect = "reconnect" // 服务端 → 客户端：服务即将关闭，稍后重新加入房间
+)
+
+const maxChatLength = 1000 // 单条文字消息最大字符数
+
+// 控制消息信封
+type Message struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	From    string          `json:"from,omitempty"`    // 发送者ID，由服务端填写
+	Session string          `json:"session,omitempty"` // 发送者会话ID，由服务端填写
+	To      string          `json:"to,omitempty"`      // 接收者ID，为空表示整个房间
+	Data    json.RawMessage `json:"data,omitempty"`
+	TS      int64           `json:"ts,omitempty"`  // 服务端时间戳（毫秒）
+	Seq     int64           `json:"seq,omitempty"` // 房间广播序号，恢复会话时据此补发
+}
+
+type errorData struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+type muteData struct {
+	Muted bool `json:"muted"`
+}
+
+type chatData struct {
+	Text string `json:"text"`
+}
+
+// 待发送的一帧数据
+type outbound struct {
+	kind     int // websocket.TextMessage 或 websocket.BinaryMessage
+	data     []byte
+	prepared *websocket.PreparedMessage // 广播时预先分帧（和压缩），所有接收者共用
+}
+
+// 广播时构造 PreparedMessage，只压缩一次。不压缩的帧（音频、未开启 WS_COMPRESSION）逐个发送更快，
+// 见 BenchmarkBroadcast10；构造失败时同样按普通帧逐个发送
+func (o outbound) prepare() outbound {
+	if o.prepared != nil || o.kind != websocket.TextMessage || !config.WSCompression {
+		return o
+	}
+	pm, err := websocket.NewPreparedMessage(o.kind, o.data)
+	if err != nil {
+		return o
+	}
+	o.prepared = pm
+	return o
+}
+
+// 构造服务端下发的控制消息
+func newMessage(msgType, from string, data interface{}) (*Message, error) {
+	msg := &Message{
+		V:    ProtocolVersion,
+		Type: msgType,
+		From: from,
+		TS:   time.Now().UnixMilli(),
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = raw
+	}
+	return msg, nil
+}
+
+func (m *Message) frame() (outbound, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return outbound{}, err
+	}
+	return outbound{kind: websocket.TextMessage, data: raw}, nil
+}
+
+// 控制消息处理函数，新的房间功能通过 registerHandler 挂载
+type messageHandler func(c *Client, msg *Message)
+
+var handlers = map[string]messageHandler{}
+
+func registerHandler(msgType string, h messageHandler) {
+	handlers[msgType] = h
+}
+
+func init() {
+	registerHandler(MsgPing, handlePing)
+	registerHandler(MsgChat, handleChat)
+	registerHandler(MsgMute, handleMute)
+	registerHandler(MsgLeave, handleLeave)
+}
+
+// 解析文本帧并按类型分发
+func (h *RoomHub) dispatch(c *Client, raw []byte) {
+	var msg Message
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	if msg.V != ProtocolVersion {
+		c.sendError(40002, "不支持的协议版本")
+		return
+	}
+
+	handler, ok := handlers[msg.Type]
+	if !ok {
+		c.sendError(40003, "不支持的消息类型: "+msg.Type)
+		return
+	}
+	// 发送者以服务端记录的为准，防止冒充
+	msg.From = c.userID
+	msg.Session = c.sessionID
+	msg.TS = time.Now().UnixMilli()
+	handler(c, &msg)
+}
+
+func handlePing(c *Client, msg *Message) {
+	pong, _ := newMessage(MsgPong, "", nil)
+	c.sendMessage(pong)
+}
+
+func handleChat(c *Client, msg *Message) {
+	var data chatData
+	if err := json.Unmarshal(msg.Data, &data); err != nil || data.Text == "" {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	if utf8.RuneCountInString(data.Text) > maxChatLength {
+		c.sendError(40004, "消息过长")
+		return
+	}
+	c.broadcastMessage(msg, false)
+}
+
+func handleMute(c *Client, msg *Message) {
+	var data muteData
+	if err := json.Unmarshal(msg.Data, &data); err != nil {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+	c.muted.Store(data.Muted)
+	c.broadcastMessage(msg, false)
+}
+
+func handleLeave(c *Client, msg *Message) {
+	c.cleanupWith(websocket.CloseNormalClosure, "")
+}
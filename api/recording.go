@@ -0,0 +1,433 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+)
+
+// 服务端 → 客户端：房间录音开始或结束，data: { active }。
+// 中转模式的客户端收到 active=true 后应重新启动 MediaRecorder，保证录音文件带有 WebM 头。
+const MsgRecording = "recording"
+
+type recordingData struct {
+	Active bool `json:"active"`
+}
+
+// 一个房间的录音，每个成员写入各自的文件
+type recorder struct {
+	roomID    int64
+	joinCode  string
+	startedBy string
+
+	mu     sync.Mutex
+	tracks map[string]*recordingTrack
+	closed bool
+}
+
+// 每个录音文件的写入队列长度，磁盘跟不上时丢弃新到的数据，不阻塞转发
+const recordingQueue = 256
+
+// 一个成员的录音文件。文件和 recordings 表记录由 run 在单独的 goroutine 中创建和写入，
+// 收到音频的 goroutine（readPump、SFU 转发）只把数据放进队列。
+type recordingTrack struct {
+	format string
+	queue  chan []byte   // 待写入的数据，只在持有 recorder.mu 时发送和关闭
+	done   chan struct{} // run 退出（文件已结束）时关闭
+	failed atomic.Bool   // 创建文件失败，之后的数据直接丢弃
+
+	// 以下字段只在 run 中访问
+	id   int64
+	path string
+	file *os.File             // WebM：直接追加客户端上传的数据
+	ogg  *oggwriter.OggWriter // Ogg：由 RTP 包封装
+}
+
+var (
+	recordersLock sync.Mutex
+	recorders     = make(map[string]*recorder) // 按邀请码索引的进行中录音
+)
+
+// 房间正在进行的录音，没有则返回 nil
+func activeRecorder(joinCode string) *recorder {
+	recordersLock.Lock()
+	defer recordersLock.Unlock()
+	return recorders[joinCode]
+}
+
+// 结束房间的录音，返回是否确实有录音被结束
+func stopRecording(joinCode string) bool {
+	recordersLock.Lock()
+	rec := recorders[joinCode]
+	delete(recorders, joinCode)
+	recordersLock.Unlock()
+
+	if rec == nil {
+		return false
+	}
+	rec.close()
+	return true
+}
+
+// 录音文件名只保留安全字符，成员ID由客户端提供，不能直接拼进路径
+func safeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// 获取或创建成员的录音文件，调用方需持有 r.mu
+func (r *recorder) trackLocked(participant, format string) *recordingTrack {
+	if r.closed {
+		return nil
+	}
+	if track, ok := r.tracks[participant]; ok {
+		return track
+	}
+	track := &recordingTrack{
+		format: format,
+		queue:  make(chan []byte, recordingQueue),
+		done:   make(chan struct{}),
+	}
+	r.tracks[participant] = track
+	go track.run(r, participant)
+	return track
+}
+
+// 记录中转模式下客户端上传的 WebM 数据
+func (r *recorder) writeWebM(participant string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if track := r.trackLocked(participant, models.RecordingWebM); track != nil && track.format == models.RecordingWebM {
+		track.enqueueLocked(data)
+	}
+}
+
+// 记录 SFU 转发的 RTP 包，目前只支持 Opus；在 SFU 转发循环中调用，不能等待磁盘或数据库
+func (r *recorder) writeRTP(participant string, codec webrtc.RTPCodecParameters, packet []byte) {
+	if !strings.EqualFold(codec.MimeType, webrtc.MimeTypeOpus) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if track := r.trackLocked(participant, models.RecordingOgg); track != nil && track.format == models.RecordingOgg {
+		track.enqueueLocked(packet)
+	}
+}
+
+// 成员离开时结束其录音文件，重新加入会生成新的文件
+func (r *recorder) closeTrack(participant string) {
+	r.mu.Lock()
+	track := r.tracks[participant]
+	delete(r.tracks, participant)
+	if track != nil {
+		close(track.queue)
+	}
+	r.mu.Unlock()
+
+	if track != nil {
+		<-track.done
+	}
+}
+
+func (r *recorder) close() {
+	r.mu.Lock()
+	r.closed = true
+	tracks := r.tracks
+	r.tracks = nil
+	for _, track := range tracks {
+		close(track.queue)
+	}
+	r.mu.Unlock()
+
+	for _, track := range tracks {
+		<-track.done
+	}
+}
+
+// 复制一份数据放进写入队列（调用方的缓冲区会被复用），队列满时丢弃。调用方需持有 recorder.mu
+func (t *recordingTrack) enqueueLocked(data []byte) {
+	if t.failed.Load() {
+		return
+	}
+	select {
+	case t.queue <- append([]byte(nil), data...):
+	default:
+	}
+}
+
+// 创建录音文件后依次写入队列中的数据，队列关闭后结束文件
+func (t *recordingTrack) run(r *recorder, participant string) {
+	defer close(t.done)
+
+	if err := t.open(r, participant); err != nil {
+		log.Printf("创建录音文件失败: %v", err)
+		utils.Logger(participant, fmt.Sprintf("Recording open error: %v", err), time.Now().Format(time.RFC3339), "")
+		// 之后的数据不再入队，已经在队列中的直接丢弃
+		t.failed.Store(true)
+		for range t.queue {
+		}
+		return
+	}
+	for data := range t.queue {
+		t.write(data)
+	}
+	t.finish()
+}
+
+// 打开成员的录音文件并写入 recordings 表
+func (t *recordingTrack) open(r *recorder, participant string) error {
+	dir := filepath.Join(config.RecordingDir, strconv.FormatInt(r.roomID, 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	now := time.Now()
+	t.path = filepath.Join(dir, fmt.Sprintf("%d_%s.%s", now.UnixNano(), safeFileName(participant), t.format))
+
+	var err error
+	if t.format == models.RecordingOgg {
+		t.ogg, err = oggwriter.New(t.path, 48000, 2)
+	} else {
+		t.file, err = os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rec := &models.Recording{
+		RoomID:      r.roomID,
+		Participant: participant,
+		Format:      t.format,
+		FilePath:    t.path,
+		StartedBy:   r.startedBy,
+		StartedAt:   now,
+	}
+	if err := config.Store.Recordings.Create(ctx, rec); err != nil {
+		t.close()
+		os.Remove(t.path)
+		return err
+	}
+	t.id = rec.ID
+	return nil
+}
+
+func (t *recordingTrack) write(data []byte) {
+	var err error
+	if t.ogg != nil {
+		var pkt rtp.Packet
+		if pkt.Unmarshal(data) != nil {
+			return
+		}
+		err = t.ogg.WriteRTP(&pkt)
+	} else {
+		_, err = t.file.Write(data)
+	}
+	if err != nil {
+		log.Printf("写入录音文件失败: %v", err)
+	}
+}
+
+func (t *recordingTrack) close() {
+	if t.ogg != nil {
+		t.ogg.Close()
+	}
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+// 关闭文件并回填文件大小和结束时间
+func (t *recordingTrack) finish() {
+	t.close()
+
+	var size int64
+	if info, err := os.Stat(t.path); err == nil {
+		size = info.Size()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := config.Store.Recordings.Finish(ctx, t.id, size, time.Now()); err != nil {
+		log.Printf("更新录音信息失败: %v", err)
+	}
+}
+
+// SFU 上行 RTP 回调
+func recordRTP(roomID, peerID string, codec webrtc.RTPCodecParameters, packet []byte) {
+	if rec := activeRecorder(roomID); rec != nil {
+		rec.writeRTP(peerID, codec, packet)
+	}
+}
+
+// 开始录音（仅房主）
+func StartRecording(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	if !room.IsOngoing() {
+		c.JSON(400, gin.H{"code": 40002, "error": "房间已结束"})
+		return
+	}
+
+	recordersLock.Lock()
+	if _, exists := recorders[room.JoinCode]; exists {
+		recordersLock.Unlock()
+		c.JSON(409, gin.H{"code": 40901, "error": "房间正在录音"})
+		return
+	}
+	recorders[room.JoinCode] = &recorder{
+		roomID:    room.ID,
+		joinCode:  room.JoinCode,
+		startedBy: c.GetString("username"),
+		tracks:    make(map[string]*recordingTrack),
+	}
+	recordersLock.Unlock()
+
+	msg, _ := newMessage(MsgRecording, "", recordingData{Active: true})
+	Hub.broadcast(room.JoinCode, msg)
+
+	c.JSON(200, gin.H{"code": 20000, "message": "开始录音"})
+}
+
+// 停止录音（仅房主）
+func StopRecording(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+	if !stopRecording(room.JoinCode) {
+		c.JSON(409, gin.H{"code": 40902, "error": "房间没有在录音"})
+		return
+	}
+
+	msg, _ := newMessage(MsgRecording, "", recordingData{Active: false})
+	Hub.broadcast(room.JoinCode, msg)
+
+	c.JSON(200, gin.H{"code": 20000, "message": "录音已停止"})
+}
+
+// 列出房间的录音（仅房主）
+func ListRecordings(c *gin.Context) {
+	room, ok := loadHostRoom(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recordings, err := config.Store.Recordings.ListByRoom(ctx, room.ID)
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50001, "error": "查询录音失败", "eventID": logID})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "recordings": recordings})
+}
+
+// 查询路由参数 :id 对应的录音，并确认当前用户是所属房间的房主；失败时已写好响应
+func loadHostRecording(c *gin.Context) (*models.Recording, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rec, err := config.Store.Recordings.Get(ctx, id)
+	var room *models.Room
+	if err == nil {
+		room, err = config.Store.Rooms.GetByID(ctx, rec.RoomID)
+	}
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40402, "error": "录音不存在"})
+		return nil, false
+	}
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50001, "error": "查询录音失败", "eventID": logID})
+		return nil, false
+	}
+	if room.Creater != c.GetString("username") {
+		c.JSON(403, gin.H{"code": 40302, "error": "只有房主可以执行该操作"})
+		return nil, false
+	}
+	return rec, true
+}
+
+// 下载录音文件（仅房主）
+func DownloadRecording(c *gin.Context) {
+	rec, ok := loadHostRecording(c)
+	if !ok {
+		return
+	}
+	if rec.IsActive() {
+		c.JSON(409, gin.H{"code": 40903, "error": "录音尚未结束"})
+		return
+	}
+	if _, err := os.Stat(rec.FilePath); err != nil {
+		c.JSON(404, gin.H{"code": 40403, "error": "录音文件不存在"})
+		return
+	}
+	c.FileAttachment(rec.FilePath, filepath.Base(rec.FilePath))
+}
+
+// 删除录音文件和记录（仅房主）
+func DeleteRecording(c *gin.Context) {
+	rec, ok := loadHostRecording(c)
+	if !ok {
+		return
+	}
+	if rec.IsActive() {
+		c.JSON(409, gin.H{"code": 40903, "error": "录音尚未结束"})
+		return
+	}
+
+	if err := os.Remove(rec.FilePath); err != nil && !os.IsNotExist(err) {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "删除录音失败", "eventID": logID})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := config.Store.Recordings.Delete(ctx, rec.ID); err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "删除录音失败", "eventID": logID})
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "录音已删除"})
+}
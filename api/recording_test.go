@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+)
+
+// 录音写入临时目录和单独的内存存储
+func newTestRecorder(t *testing.T, roomID int64) *recorder {
+	oldDir, oldStore := config.RecordingDir, config.Store
+	config.RecordingDir = t.TempDir()
+	config.Store = store.NewMemory()
+	t.Cleanup(func() { config.RecordingDir, config.Store = oldDir, oldStore })
+	return &recorder{
+		roomID:    roomID,
+		joinCode:  "REC001",
+		startedBy: "alice",
+		tracks:    make(map[string]*recordingTrack),
+	}
+}
+
+func roomRecordings(t *testing.T, roomID int64) []models.Recording {
+	t.Helper()
+	list, err := config.Store.Recordings.ListByRoom(context.Background(), roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func TestRecordingWritesWebMInOrder(t *testing.T) {
+	rec := newTestRecorder(t, 101)
+
+	// 调用方会复用缓冲区，入队时必须复制
+	buf := make([]byte, 1)
+	var want []byte
+	for i := 0; i < 100; i++ {
+		buf[0] = byte(i)
+		rec.writeWebM("v1", buf)
+		want = append(want, byte(i))
+	}
+	rec.closeTrack("v1")
+
+	list := roomRecordings(t, 101)
+	if len(list) != 1 {
+		t.Fatalf("录音记录 %d 条，期望 1", len(list))
+	}
+	if list[0].IsActive() || list[0].Size != int64(len(want)) || list[0].Format != models.RecordingWebM {
+		t.Fatalf("录音记录 = %+v", list[0])
+	}
+	got, err := os.ReadFile(list[0].FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("文件内容 %v，期望 %v", got, want)
+	}
+}
+
+// 创建录音记录时阻塞，模拟数据库变慢
+type blockingRecordings struct {
+	store.RecordingStore
+	release chan struct{}
+}
+
+func (b *blockingRecordings) Create(ctx context.Context, rec *models.Recording) error {
+	<-b.release
+	return b.RecordingStore.Create(ctx, rec)
+}
+
+// SFU 转发循环中调用 writeRTP，数据库或磁盘变慢时不能阻塞转发
+func TestRecordingRTPDoesNotBlockForwarding(t *testing.T) {
+	rec := newTestRecorder(t, 102)
+	blocking := &blockingRecordings{RecordingStore: config.Store.Recordings, release: make(chan struct{})}
+	config.Store.Recordings = blocking
+	codec := webrtc.RTPCodecParameters{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for i := 0; i < 50; i++ {
+			pkt := rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: uint16(i), Timestamp: uint32(i * 960), SSRC: 1},
+				Payload: []byte{0xf8, 0xff, 0xfe},
+			}
+			raw, _ := pkt.Marshal()
+			rec.writeRTP("v2", codec, raw)
+		}
+	}()
+	select {
+	case <-written:
+	case <-time.After(2 * time.Second):
+		t.Fatal("writeRTP 等待了录音记录的创建")
+	}
+
+	close(blocking.release)
+	rec.close()
+
+	list := roomRecordings(t, 102)
+	if len(list) != 1 || list[0].IsActive() || list[0].Format != models.RecordingOgg || list[0].Size == 0 {
+		t.Fatalf("录音记录 = %+v", list)
+	}
+	// 录音结束后不再创建新的文件
+	rec.writeRTP("v3", codec, []byte{0x80})
+	if len(roomRecordings(t, 102)) != 1 {
+		t.Fatal("录音结束后仍然创建了新文件")
+	}
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+)
+
+// 恢复会话：连接意外断开后，成员在 config.ResumeGrace 内仍保留在房间中（其他成员不会收到 leave），
+// 客户端带上 hello 中的 resume_token 和收到的最大 seq 重新连接 /ws，即可恢复原来的身份、静音状态和名单位置，
+// 并补发断线期间错过的广播控制消息。
+
+// 生成恢复令牌，不支持恢复会话时为空
+func newResumeKey() (string, error) {
+	if config.ResumeGrace == 0 {
+		return "", nil
+	}
+	return utils.RandomToken(16)
+}
+
+func (c *Client) hello(resumed bool) *Message {
+	data := gin.H{"version": ProtocolVersion, "user_id": c.userID, "session_id": c.sessionID}
+	if c.resumeKey != "" {
+		data["resume_token"] = c.resumeKey
+	}
+	if resumed {
+		data["resumed"] = true
+	}
+	msg, _ := newMessage(MsgHello, "", data)
+	return msg
+}
+
+// 恢复断线前的会话：/ws?join_code=...&resume=...&since=...
+func resumeSession(c *gin.Context, roomID, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	room, err := config.Store.Rooms.GetByJoinCode(ctx, roomID)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(500, gin.H{"code": 50002, "error": "查询房间状态失败"})
+		log.Println("查询房间失败:", err)
+		return
+	}
+	// 房间不存在、已结束和令牌无效回复相同的结果，不能通过恢复接口探测加入码
+	if err == store.ErrNotFound {
+		recordJoinMiss(ctx, c, models.JoinSourceWebSocket, roomID, "")
+	}
+	if err != nil || !Hub.resumable(roomID, key) {
+		c.JSON(401, gin.H{"code": 40103, "error": "会话已过期，请重新加入房间"})
+		return
+	}
+	if !room.IsOngoing() {
+		c.JSON(400, gin.H{"code": 40002, "error": "房间已结束"})
+		return
+	}
+
+	resumeKey, err := newResumeKey()
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50001, "error": "生成会话ID失败"})
+		return
+	}
+	// 未提供或格式错误时不补发，改为下发名单快照
+	since, err := strconv.ParseInt(c.Query("since"), 10, 64)
+	if err != nil {
+		since = -1
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket升级失败: %v\n", err)
+		c.JSON(500, gin.H{
+			"code":  50001,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	client := &Client{
+		conn:      conn,
+		roomID:    roomID,
+		roomDBID:  room.ID,
+		ip:        c.ClientIP(),
+		media:     room.MediaMode,
+		resumeKey: resumeKey,
+		send:      make(chan outbound, 256),
+		audio:     make(chan outbound, 256),
+		done:      make(chan struct{}),
+	}
+
+	old, ok := Hub.resume(client, key, since)
+	if !ok {
+		// 预检查之后会话恰好过期
+		client.sendError(40103, "会话已过期，请重新加入房间")
+		client.closeConn(websocket.ClosePolicyViolation, "会话已过期")
+		client.startWriter()
+		return
+	}
+	// 网络异常时服务端可能还没有发现旧连接已断开
+	old.closeConn(websocket.CloseNormalClosure, "已在其他连接中恢复会话")
+	if client.media == models.MediaSFU {
+		// PeerConnection 保持不变，之后的 offer 和 candidate 发给新连接
+		rebindSFU(client)
+	}
+
+	if rec := activeRecorder(roomID); rec != nil {
+		// 中转模式的客户端会重启 MediaRecorder，新的数据写入新的录音文件
+		if client.media != models.MediaSFU {
+			rec.closeTrack(client.stream)
+		}
+		notice, _ := newMessage(MsgRecording, "", recordingData{Active: true})
+		client.sendMessage(notice)
+	}
+	expiry.schedule(room.ID, roomID, room.ExpireTime)
+
+	client.start()
+}
+
+// 断线的连接保留在房间中等待恢复，连接已不在房间时返回 false
+func (h *RoomHub) suspend(c *Client) bool {
+	if c.room == nil {
+		return false
+	}
+	suspended := false
+	c.room.do(func(r *room) {
+		if r.members[c.sessionID] != c {
+			return
+		}
+		suspended = true
+		if c.grace == nil {
+			// 超时后按正常离开处理，期间恢复的话 members 中已是新连接，leave 不会生效
+			c.grace = time.AfterFunc(config.ResumeGrace, c.leaveRoom)
+		}
+	})
+	return suspended
+}
+
+// 取消等待恢复的定时器，只在房间 goroutine 中调用
+func (c *Client) stopGrace() {
+	if c.grace != nil {
+		c.grace.Stop()
+	}
+}
+
+// 房间中是否有持有该恢复令牌的会话
+func (h *RoomHub) resumable(roomID, key string) bool {
+	found := false
+	h.do(roomID, func(r *room) {
+		old := r.memberByResumeKey(key)
+		found = old != nil && !old.evicted.Load()
+	})
+	return found
+}
+
+// 用新连接接替持有恢复令牌的会话，返回被接替的旧连接
+func (h *RoomHub) resume(c *Client, key string, since int64) (old *Client, ok bool) {
+	r := h.get(c.roomID)
+	if r == nil {
+		return nil, false
+	}
+	c.room = r
+	r.do(func(r *room) {
+		old = r.resume(c, key, since)
+	})
+	return old, old != nil
+}
+
+func (r *room) memberByResumeKey(key string) *Client {
+	if key == "" {
+		return nil
+	}
+	for _, peer := range r.members {
+		if subtle.ConstantTimeCompare([]byte(peer.resumeKey), []byte(key)) == 1 {
+			return peer
+		}
+	}
+	return nil
+}
+
+// 接替会话：沿用旧连接的身份和状态，随后下发 hello 和错过的消息，只在房间 goroutine 中调用
+func (r *room) resume(c *Client, key string, since int64) *Client {
+	old := r.memberByResumeKey(key)
+	// 已被移出、正在断开的会话不能恢复
+	if old == nil || old.evicted.Load() {
+		return nil
+	}
+	old.stopGrace()
+
+	c.userID = old.userID
+	c.sessionID = old.sessionID
+	c.stream = old.stream
+	c.name = old.name
+	c.host = old.host
+	c.joinedAt = old.joinedAt
+	c.muted.Store(old.muted.Load())
+	c.forceMuted.Store(old.forceMuted.Load())
+	r.members[c.sessionID] = c
+
+	c.sendMessage(c.hello(true))
+	r.replay(c, since)
+	return old
+}
+
+// 补发 since 之后的广播，记录已不完整或条数过多时改为下发名单快照
+func (r *room) replay(c *Client, since int64) {
+	if since == r.seq {
+		return
+	}
+	if since < 0 || since > r.seq || len(r.history) == 0 || r.history[0].seq > since+1 ||
+		r.seq-since > int64(cap(c.send)/2) {
+		r.sendRoster(c)
+		return
+	}
+	for _, e := range r.history {
+		if e.seq > since && e.exclude != c.sessionID {
+			c.enqueue(e.frame)
+		}
+	}
+}
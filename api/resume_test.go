@@ -0,0 +1,375 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"talkFlow/config"
+	"talkFlow/models"
+)
+
+func withResumeGrace(t *testing.T, grace time.Duration) {
+	old := config.ResumeGrace
+	config.ResumeGrace = grace
+	t.Cleanup(func() { config.ResumeGrace = old })
+}
+
+// 加入 Hub 并分配恢复令牌
+func joinResumable(t *testing.T, code, userID string) *Client {
+	t.Helper()
+	c := newTestClient(code, userID)
+	c.resumeKey = "key-" + c.sessionID
+	if _, ok := Hub.join(c); !ok {
+		t.Fatalf("%s 加入房间被拒绝", userID)
+	}
+	return c
+}
+
+// 恢复会话用的新连接，身份由 resume 填写
+func resumingClient(code string) *Client {
+	c := newTestClient(code, "")
+	c.resumeKey = fmt.Sprintf("key-new-%d", testSessions.Add(1))
+	return c
+}
+
+// 取出发送队列中已有的控制消息
+func queued(t *testing.T, c *Client) []*Message {
+	t.Helper()
+	var list []*Message
+	for {
+		select {
+		case frame := <-c.send:
+			var msg Message
+			if err := json.Unmarshal(frame.data, &msg); err != nil {
+				t.Fatalf("无法解析的控制消息: %v", err)
+			}
+			list = append(list, &msg)
+		default:
+			return list
+		}
+	}
+}
+
+func types(list []*Message) []string {
+	var names []string
+	for _, msg := range list {
+		names = append(names, msg.Type)
+	}
+	return names
+}
+
+func closeAll(t *testing.T, clients ...*Client) {
+	for _, c := range clients {
+		c.cleanupWith(websocket.CloseNormalClosure, "")
+	}
+	waitForEmptyHub(t, Hub)
+}
+
+// 在房间 goroutine 中同步广播，避免和 broadcast 队列中的消息乱序
+func publishSync(t *testing.T, code string, msg *Message, exclude string) {
+	t.Helper()
+	if !Hub.do(code, func(r *room) { r.publishLocal(msg, exclude) }) {
+		t.Fatal("房间不在线")
+	}
+}
+
+func roomSeq(code string) int64 {
+	var seq int64
+	Hub.do(code, func(r *room) { seq = r.seq })
+	return seq
+}
+
+func TestResumeAfterGraceExpired(t *testing.T) {
+	withResumeGrace(t, 50*time.Millisecond)
+	const code = "RS0001"
+	a := joinResumable(t, code, "alice")
+	b := joinResumable(t, code, "bob")
+	defer closeAll(t, a, b)
+	queued(t, b)
+
+	a.disconnect()
+	deadline := time.Now().Add(5 * time.Second)
+	for Hub.member(code, "alice") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("等待恢复超时后成员没有离开")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := types(queued(t, b)); len(got) != 1 || got[0] != MsgLeave {
+		t.Fatalf("其他成员收到 %v，期望一条 leave", got)
+	}
+
+	if Hub.resumable(code, a.resumeKey) {
+		t.Fatal("超时后仍然可以恢复")
+	}
+	late := resumingClient(code)
+	if _, ok := Hub.resume(late, a.resumeKey, 0); ok {
+		t.Fatal("超时后恢复成功")
+	}
+	if Hub.member(code, "alice") != nil {
+		t.Fatal("超时后恢复的会话重新出现在房间中")
+	}
+}
+
+func TestConcurrentResumeSameToken(t *testing.T) {
+	withResumeGrace(t, time.Minute)
+	const code = "RS0002"
+	a := joinResumable(t, code, "alice")
+	b := joinResumable(t, code, "bob")
+	a.disconnect()
+
+	const attempts = 10
+	candidates := make([]*Client, attempts)
+	results := make([]bool, attempts)
+	var wg sync.WaitGroup
+	for i := range candidates {
+		candidates[i] = resumingClient(code)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			old, ok := Hub.resume(candidates[i], a.resumeKey, -1)
+			if ok && old != a {
+				t.Errorf("接替的不是原来的会话")
+			}
+			results[i] = ok
+		}(i)
+	}
+	wg.Wait()
+	defer closeAll(t, append(candidates, a, b)...)
+
+	var winner *Client
+	for i, ok := range results {
+		if !ok {
+			continue
+		}
+		if winner != nil {
+			t.Fatal("同一个恢复令牌被使用了两次")
+		}
+		winner = candidates[i]
+	}
+	if winner == nil {
+		t.Fatal("没有一个恢复成功")
+	}
+	if winner.userID != "alice" || winner.sessionID != a.sessionID {
+		t.Fatalf("恢复后身份为 %s/%s", winner.userID, winner.sessionID)
+	}
+	if !isLiveMember(Hub, winner) {
+		t.Fatal("恢复的连接不在房间中")
+	}
+	for _, msg := range queued(t, b) {
+		if msg.Type == MsgLeave {
+			t.Fatal("恢复期间其他成员收到了 leave")
+		}
+	}
+	// 旧令牌已经作废，新连接使用自己的令牌
+	if Hub.resumable(code, a.resumeKey) || !Hub.resumable(code, winner.resumeKey) {
+		t.Fatal("恢复后令牌没有轮换")
+	}
+}
+
+func TestResumeReplaysMissedBroadcasts(t *testing.T) {
+	withResumeGrace(t, time.Minute)
+	const code = "RS0003"
+	a := joinResumable(t, code, "alice")
+	b := joinResumable(t, code, "bob")
+	since := roomSeq(code)
+	a.disconnect()
+
+	for i := 0; i < 3; i++ {
+		msg, _ := newMessage(MsgChat, "bob", chatData{Text: fmt.Sprint(i)})
+		publishSync(t, code, msg, b.sessionID)
+	}
+	// 本来就不发给 alice 的消息不补发
+	private, _ := newMessage(MsgChat, "bob", chatData{Text: "skip"})
+	publishSync(t, code, private, a.sessionID)
+
+	c := resumingClient(code)
+	if _, ok := Hub.resume(c, a.resumeKey, since); !ok {
+		t.Fatal("恢复失败")
+	}
+	defer closeAll(t, a, b, c)
+
+	got := queued(t, c)
+	if len(got) != 4 || got[0].Type != MsgHello {
+		t.Fatalf("收到 %v，期望 hello 和 3 条补发", types(got))
+	}
+	for i, msg := range got[1:] {
+		var data chatData
+		json.Unmarshal(msg.Data, &data)
+		if msg.Type != MsgChat || msg.Seq != since+int64(i)+1 || data.Text != fmt.Sprint(i) {
+			t.Fatalf("第 %d 条补发为 %s seq=%d %q", i, msg.Type, msg.Seq, data.Text)
+		}
+	}
+}
+
+func TestResumeAfterGapSendsRoster(t *testing.T) {
+	withResumeGrace(t, time.Minute)
+	old := config.ResumeBuffer
+	config.ResumeBuffer = 2
+	t.Cleanup(func() { config.ResumeBuffer = old })
+
+	cases := []struct {
+		name  string
+		since func(seq int64) int64
+	}{
+		{"超出补发缓冲", func(seq int64) int64 { return seq }},
+		{"未提供序号", func(int64) int64 { return -1 }},
+		{"序号大于房间序号", func(int64) int64 { return 1 << 40 }},
+	}
+	for i, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code := fmt.Sprintf("RG%04d", i)
+			a := joinResumable(t, code, "alice")
+			b := joinResumable(t, code, "bob")
+			since := tc.since(roomSeq(code))
+			a.disconnect()
+			for n := 0; n < 5; n++ {
+				msg, _ := newMessage(MsgChat, "bob", chatData{Text: "hi"})
+				publishSync(t, code, msg, "")
+			}
+
+			c := resumingClient(code)
+			if _, ok := Hub.resume(c, a.resumeKey, since); !ok {
+				t.Fatal("恢复失败")
+			}
+			defer closeAll(t, a, b, c)
+
+			got := queued(t, c)
+			if len(got) != 2 || got[0].Type != MsgHello || got[1].Type != MsgRoster {
+				t.Fatalf("收到 %v，期望 hello 和名单快照", types(got))
+			}
+			if got[1].Seq != roomSeq(code) {
+				t.Fatalf("名单快照 seq=%d，期望 %d", got[1].Seq, roomSeq(code))
+			}
+		})
+	}
+}
+
+// 移出或封禁与恢复会话同时发生时，被移出的访客不能借恢复留在房间中
+func TestResumeRacingKick(t *testing.T) {
+	withResumeGrace(t, time.Minute)
+	for i := 0; i < 100; i++ {
+		code := fmt.Sprintf("RK%04d", i%10)
+		a := joinResumable(t, code, "alice")
+		host := joinResumable(t, code, "host")
+		drain(host)
+		a.disconnect()
+
+		c := resumingClient(code)
+		var resumed bool
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, resumed = Hub.resume(c, a.resumeKey, -1)
+		}()
+		go func() {
+			defer wg.Done()
+			Hub.kick(code, "alice", "", "测试", "host")
+		}()
+		wg.Wait()
+
+		if Hub.member(code, "alice") != nil {
+			t.Fatalf("第 %d 轮: 被移出的访客通过恢复会话留在了房间中", i)
+		}
+		if resumed {
+			select {
+			case <-c.done:
+			default:
+				t.Fatalf("第 %d 轮: 恢复的连接没有被断开", i)
+			}
+		}
+		closeAll(t, a, host, c)
+	}
+}
+
+// 恢复会话时不需要入场凭证，房间不存在和已结束必须与令牌无效回复相同的结果
+func TestResumeDoesNotRevealRooms(t *testing.T) {
+	withResumeGrace(t, time.Minute)
+	ctx := context.Background()
+	for code, status := range map[string]models.RoomStatus{"PROBE1": models.RoomOngoing, "PROBE2": models.RoomEnded} {
+		err := config.Store.Rooms.Create(ctx, &models.Room{
+			Name: code, Creater: "alice", JoinCode: code, Status: status,
+			CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour), MediaMode: models.MediaMesh,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/ws", TalkHandler)
+	const ip = "198.51.100.23"
+	resume := func(code string) (int, string) {
+		req := httptest.NewRequest("GET", "/ws?join_code="+code+"&resume=guess", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	wantStatus, wantBody := resume("PROBE1")
+	if wantStatus != 401 {
+		t.Fatalf("令牌无效时状态码 %d: %s", wantStatus, wantBody)
+	}
+	for _, code := range []string{"PROBE2", "NOPE99"} {
+		if status, body := resume(code); status != wantStatus || body != wantBody {
+			t.Fatalf("%s 回复 %d %s，与令牌无效时的 %d %s 不同", code, status, body, wantStatus, wantBody)
+		}
+	}
+
+	// 不存在的加入码仍然计入失败次数
+	misses, _, err := config.Store.JoinFailures.CountByIP(ctx, ip, time.Now().Add(-time.Minute))
+	if err != nil || misses != 1 {
+		t.Fatalf("失败记录 %d 条, %v，期望 1", misses, err)
+	}
+}
+
+// replace 策略下同一访客重新加入会替换等待恢复的旧会话，旧会话的定时器到期后不能关闭新连接的录音
+func TestReplacedSuspendedSessionKeepsRecording(t *testing.T) {
+	withResumeGrace(t, 50*time.Millisecond)
+	oldPolicy := config.SessionPolicy
+	config.SessionPolicy = config.SessionReplace
+	t.Cleanup(func() { config.SessionPolicy = oldPolicy })
+
+	const code = "GRACE1"
+	rec := newTestRecorder(t, 301)
+	recordersLock.Lock()
+	recorders[code] = rec
+	recordersLock.Unlock()
+	t.Cleanup(func() { stopRecording(code) })
+
+	bob := joinResumable(t, code, "bob")
+	drain(bob)
+	first := joinResumable(t, code, "alice")
+	first.disconnect()
+
+	second := newTestClient(code, "alice")
+	replaced, ok := Hub.join(second)
+	if !ok || replaced != first {
+		t.Fatalf("重新加入 = %v, %v，期望替换等待恢复的会话", replaced, ok)
+	}
+	drain(second)
+	defer closeAll(t, bob, second)
+	replaced.cleanupWith(websocket.CloseNormalClosure, "已在其他连接中加入房间")
+
+	// 新连接开始录音，等旧会话的定时器到期
+	rec.writeWebM(second.stream, []byte{1})
+	time.Sleep(4 * config.ResumeGrace)
+
+	rec.mu.Lock()
+	_, open := rec.tracks[second.stream]
+	rec.mu.Unlock()
+	if !open {
+		t.Fatal("旧会话的定时器到期后关闭了新连接的录音")
+	}
+}
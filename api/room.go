@@ -2,33 +2,73 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
 	"log"
-	"math/rand"
+	"math/big"
+	"net/url"
 	"strconv"
 	"strings"
 	"talkFlow/config"
 	"talkFlow/models"
+	"talkFlow/store"
 	"talkFlow/utils"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
 
-// 生成房间的随机号
-func randomJoinCode(length int) string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+// 生成房间的随机号，长度和字符集见 config.InitJoinCode
+func randomJoinCode() (string, error) {
+	charset := config.JoinCodeAlphabet
+	n := big.NewInt(int64(len(charset)))
 	var sb strings.Builder
-	for i := 0; i < length; i++ {
-		sb.WriteByte(charset[seededRand.Intn(len(charset))])
+	for i := 0; i < config.JoinCodeLength; i++ {
+		idx, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(charset[idx.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// 生成加入码时最多尝试的次数，字符集和长度足够时几乎不会冲突
+const joinCodeAttempts = 5
+
+// 以新的加入码创建房间，冲突时换一个重试；加入码被已过期的房间占用时先将其结束再使用
+func createWithJoinCode(ctx context.Context, room *models.Room) error {
+	var err error
+	for i := 0; i < joinCodeAttempts; i++ {
+		if room.JoinCode, err = randomJoinCode(); err != nil {
+			return err
+		}
+		var ended bool
+		if ended, err = config.Store.Rooms.EndExpired(ctx, room.JoinCode, time.Now()); err != nil {
+			return err
+		}
+		if ended {
+			// 房间过期时没有成员在线就不会触发到期调度，这里补上清理，避免残留的连接进入新房间
+			Hub.closeRoom(room.JoinCode, "房间已过期")
+		}
+
+		err = config.Store.Rooms.Create(ctx, room)
+		if err != store.ErrDuplicate {
+			return err
+		}
+		log.Println("加入码冲突，重新生成:", room.JoinCode)
 	}
-	return sb.String()
+	return err
 }
 
+// 显示昵称的最大字符数
+const maxNameLength = 32
+
 // 前端传来的时间应当是分钟数
 type CreateRoomRequest struct {
 	Name       string `json:"name" binding:"required"`
 	ExpireTime string `json:"expire_time" binding:"required"`
+	MediaMode  string `json:"media_mode"` // mesh（默认）或 sfu
 }
 
 func CreateRoom(c *gin.Context) {
@@ -62,31 +102,33 @@ func CreateRoom(c *gin.Context) {
 		return
 	}
 
-	JoinCode := randomJoinCode(5)
+	mediaMode := req.MediaMode
+	if mediaMode == "" {
+		mediaMode = models.MediaMesh
+	}
+	if mediaMode != models.MediaMesh && mediaMode != models.MediaSFU {
+		c.JSON(400, gin.H{
+			"code":  40003,
+			"error": "不支持的音频模式",
+		})
+		return
+	}
 
 	room := models.Room{
 		Creater:    username.(string),
 		Name:       req.Name,
 		Joiner:     []string{username.(string)},
-		JoinCode:   JoinCode,
 		CreateTime: time.Now(),
 		ExpireTime: time.Now().Add(time.Duration(expireMinutes) * time.Minute), // 过期时间
 		Status:     models.RoomOngoing,                                         // 0: 进行中
 		IP:         c.ClientIP(),                                               // 获取创建房间的IP
+		MediaMode:  mediaMode,
 	}
 
-	insertSQL := `
-		INSERT INTO rooms (creater, name, joiner, join_code, create_time, expire_time, status, ip)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	// 将 joiner 字段（string slice）序列化为字符串存储到数据库
-	joinerStr := strings.Join(room.Joiner, ",")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	_, err = config.DB.ExecContext(context.Background(), insertSQL,
-		room.Creater, room.Name, joinerStr, room.JoinCode,
-		room.CreateTime, room.ExpireTime, room.Status, room.IP,
-	)
+	err = createWithJoinCode(ctx, &room)
 	if err != nil {
 		var logMsg string
 		if err != nil {
@@ -105,9 +147,10 @@ func CreateRoom(c *gin.Context) {
 	}
 
 	c.JSON(200, gin.H{
-		"code":      20000,
-		"message":   "房间创建成功",
-		"join_code": JoinCode,
+		"code":       20000,
+		"message":    "房间创建成功",
+		"join_code":  room.JoinCode,
+		"media_mode": mediaMode,
 	})
 
 }
@@ -119,6 +162,10 @@ func JoinRoom(c *gin.Context) {
 	var req struct {
 		JoinCode  string `json:"join_code" binding:"required"`
 		VisitorID string `json:"visitor_id" binding:"required"`
+		Name      string `json:"name"` // 可选的显示昵称，默认使用访客ID
+		// 加入码输错多次后需要提供的工作量证明
+		Challenge string `json:"challenge"`
+		Solution  string `json:"solution"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -130,11 +177,14 @@ func JoinRoom(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var existingRoom int
-	checkRoomSQL := `SELECT COUNT(*) FROM rooms WHERE join_code = ?`
-	err := config.DB.QueryRowContext(ctx, checkRoomSQL, req.JoinCode).Scan(&existingRoom)
+	misses, ok := checkJoinLimit(ctx, c, req.VisitorID)
+	if !ok || !checkJoinChallenge(ctx, c, misses, req.Challenge, req.Solution) {
+		return
+	}
 
-	if err != nil || existingRoom == 0 {
+	room, err := config.Store.Rooms.GetByJoinCode(ctx, req.JoinCode)
+	if err == store.ErrNotFound {
+		recordJoinMiss(ctx, c, models.JoinSourceJoin, req.JoinCode, req.VisitorID)
 		c.JSON(404, gin.H{
 			"code":  40401,
 			"error": "房间不存在",
@@ -142,11 +192,6 @@ func JoinRoom(c *gin.Context) {
 		log.Println("房间不存在:", req.JoinCode)
 		return
 	}
-
-	// 这里如果需要判断房间是否结束，应该先查出房间的 status 字段
-	var status int
-	statusSQL := `SELECT status FROM rooms WHERE join_code = ?`
-	err = config.DB.QueryRowContext(ctx, statusSQL, req.JoinCode).Scan(&status)
 	if err != nil {
 		c.JSON(500, gin.H{
 			"code":  50002,
@@ -156,31 +201,6 @@ func JoinRoom(c *gin.Context) {
 		return
 	}
 
-	// 查询房间信息到 room 结构体
-	var room models.Room
-	roomSQL := `SELECT id, creater, name, joiner, join_code, create_time, expire_time, status, ip FROM rooms WHERE join_code = ?`
-	err = config.DB.QueryRowContext(ctx, roomSQL, req.JoinCode).Scan(
-		&room.ID,
-		&room.Creater,
-		&room.Name,
-		&room.JoinerStr, // 先用字符串接收
-		&room.JoinCode,
-		&room.CreateTime,
-		&room.ExpireTime,
-		&room.Status,
-		&room.IP,
-	)
-	if err != nil {
-		c.JSON(404, gin.H{
-			"code":  40401,
-			"error": "房间不存在",
-		})
-		log.Println("房间不存在:", req.JoinCode)
-		return
-	}
-	// 反序列化 joiner 字段
-	room.Joiner = strings.Split(room.JoinerStr, ",")
-
 	// 查询房间信息到 room 结构体后
 	if !room.IsOngoing() {
 		c.JSON(400, gin.H{
@@ -191,11 +211,40 @@ func JoinRoom(c *gin.Context) {
 		return
 	}
 
-	insertVisitorSQL := `
-        INSERT INTO visitor (visitor_id, created_at, visitor_ip, is_register)
-        VALUES (?, ?, ?, ?)
-    `
-	_, err = config.DB.ExecContext(ctx, insertVisitorSQL, req.VisitorID, time.Now(), c.ClientIP(), false)
+	// 带着房主的访问令牌加入时签发房主凭证，房主不受封禁限制
+	host := c.GetString("username") != "" && c.GetString("username") == room.Creater
+	if room.Locked && !host {
+		c.JSON(403, gin.H{
+			"code":  40305,
+			"error": "房间已锁定",
+		})
+		return
+	}
+	if !host {
+		banned, err := config.Store.Bans.IsBanned(ctx, room.ID, req.VisitorID, c.ClientIP())
+		if err != nil {
+			c.JSON(500, gin.H{
+				"code":  50002,
+				"error": "查询封禁记录失败",
+			})
+			log.Println("查询封禁记录失败:", err)
+			return
+		}
+		if banned {
+			c.JSON(403, gin.H{
+				"code":  40304,
+				"error": "已被禁止加入该房间",
+			})
+			return
+		}
+	}
+
+	err = config.Store.Visitors.Create(ctx, &models.Visitor{
+		VisitorID:  req.VisitorID,
+		CreatedAt:  time.Now(),
+		VisitorIP:  c.ClientIP(),
+		IsRegister: false,
+	})
 	if err != nil {
 		logID, _ := utils.Logger(req.VisitorID, err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
 		log.Println("记录访客失败:", err)
@@ -208,23 +257,133 @@ func JoinRoom(c *gin.Context) {
 		return
 	}
 
-	// 查询房间ID（假设rooms表有id字段且为INTEGER PRIMARY KEY AUTOINCREMENT）
-	var roomID int64
-	getRoomIDSQL := `SELECT id FROM rooms WHERE join_code = ?`
-	err = config.DB.QueryRowContext(ctx, getRoomIDSQL, req.JoinCode).Scan(&roomID)
+	// 签发入场凭证，WebSocket 连接必须携带
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxNameLength {
+		name = req.VisitorID
+	}
+	ticket, ticketExp, err := utils.GenerateRoomTicket(room.ID, req.VisitorID, name, host, room.ExpireTime)
 	if err != nil {
+		logID, _ := utils.Logger(req.VisitorID, err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
 		c.JSON(500, gin.H{
-			"code":  50003,
-			"error": "获取房间ID失败",
+			"code":    50004,
+			"error":   "生成入场凭证失败",
+			"eventID": logID,
 		})
-		log.Println("获取房间ID失败:", err)
+		log.Println("生成入场凭证失败:", err)
 		return
 	}
 
 	c.JSON(200, gin.H{
-		"code":    20000,
-		"message": "加入房间成功",
-		"room":    roomID,
-		"url":     "/api/v1/ws?join_code=" + req.JoinCode + "&id=" + req.VisitorID,
+		"code":              20000,
+		"message":           "加入房间成功",
+		"room":              room.ID,
+		"ticket":            ticket,
+		"ticket_expires_in": int(time.Until(ticketExp).Seconds()),
+		"ice_servers":       config.ICEServers,
+		"media_mode":        room.MediaMode,
+		"host":              host,
+		"url":               "/api/v1/ws?join_code=" + url.QueryEscape(req.JoinCode) + "&ticket=" + url.QueryEscape(ticket),
 	})
 }
+
+// 获取房间当前在线成员，需要该房间的入场凭证（?ticket=）或房主的访问令牌。
+// 锁定和封禁的校验与 /ws 一致；名单中不包含会话ID，会话ID只在 WebSocket 内下发。
+func GetParticipants(c *gin.Context) {
+	joinCode := c.Param("code")
+	username := c.GetString("username")
+
+	// 先校验凭证再查询房间，没有凭证时无法通过响应判断加入码是否存在
+	var claims *utils.RoomClaims
+	if ticket := c.Query("ticket"); ticket != "" || username == "" {
+		var err error
+		if claims, err = utils.ParseRoomTicket(ticket); err != nil {
+			c.JSON(401, gin.H{"code": 40102, "error": "入场凭证无效或已过期"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, ok := checkJoinLimit(ctx, c, ""); !ok {
+		return
+	}
+	room, err := config.Store.Rooms.GetByJoinCode(ctx, joinCode)
+	if err == nil {
+		// 凭证属于其他房间，或者登录用户不是房主，同样回复房间不存在
+		host := username != "" && username == room.Creater
+		if !host && (claims == nil || claims.RoomID != room.ID) {
+			err = store.ErrNotFound
+		}
+	}
+	if err != nil {
+		if err == store.ErrNotFound {
+			visitorID := ""
+			if claims != nil {
+				visitorID = claims.VisitorID
+			}
+			recordJoinMiss(ctx, c, models.JoinSourceParticipants, joinCode, visitorID)
+		}
+		c.JSON(404, gin.H{
+			"code":  40401,
+			"error": "房间不存在",
+		})
+		return
+	}
+	if !room.IsOngoing() {
+		c.JSON(400, gin.H{"code": 40002, "error": "房间已结束"})
+		return
+	}
+
+	if username != room.Creater && !claims.Host {
+		if room.Locked {
+			c.JSON(403, gin.H{"code": 40305, "error": "房间已锁定"})
+			return
+		}
+		banned, err := config.Store.Bans.IsBanned(ctx, room.ID, claims.VisitorID, c.ClientIP())
+		if err != nil {
+			c.JSON(500, gin.H{"code": 50002, "error": "查询封禁记录失败"})
+			log.Println("查询封禁记录失败:", err)
+			return
+		}
+		if banned {
+			c.JSON(403, gin.H{"code": 40304, "error": "已被禁止加入该房间"})
+			return
+		}
+	}
+
+	participants := Hub.roster(joinCode)
+	for i := range participants {
+		participants[i].SessionID = ""
+	}
+	c.JSON(200, gin.H{
+		"code":         20000,
+		"count":        len(participants),
+		"participants": participants,
+	})
+}
+
+// 查询路由参数 :code 对应的房间，并确认当前登录用户是房主；失败时已写好响应
+func loadHostRoom(c *gin.Context) (*models.Room, bool) {
+	username := c.GetString("username")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	room, err := config.Store.Rooms.GetByJoinCode(ctx, c.Param("code"))
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40401, "error": "房间不存在"})
+		return nil, false
+	}
+	if err != nil {
+		logID, _ := utils.Logger(username, err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50002, "error": "查询房间失败", "eventID": logID})
+		return nil, false
+	}
+	if room.Creater != username {
+		c.JSON(403, gin.H{"code": 40302, "error": "只有房主可以执行该操作"})
+		return nil, false
+	}
+	return room, true
+}
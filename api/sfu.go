@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/pion/webrtc/v4"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/sfu"
+)
+
+// 客户端 → 服务端：请求加入房间的 SFU，服务端随后下发 offer
+const MsgSFUJoin = "sfu_join"
+
+var sfuManager *sfu.Manager
+
+// 初始化内置 SFU（main 启动时调用一次即可）
+func InitSFU() {
+	iceServers := make([]webrtc.ICEServer, 0, len(config.ICEServers))
+	for _, s := range config.ICEServers {
+		iceServers = append(iceServers, webrtc.ICEServer{
+			URLs:       s.URLs,
+			Username:   s.Username,
+			Credential: s.Credential,
+		})
+	}
+
+	manager, err := sfu.NewManager(sfu.Config{
+		ICEServers: iceServers,
+		PublicIPs:  config.SFUPublicIPs,
+		PortMin:    config.SFUPortMin,
+		PortMax:    config.SFUPortMax,
+		OnRTP:      recordRTP,
+	})
+	if err != nil {
+		log.Fatalf("初始化 SFU 失败: %v", err)
+	}
+	sfuManager = manager
+}
+
+func init() {
+	registerHandler(MsgSFUJoin, handleSFUJoin)
+}
+
+func handleSFUJoin(c *Client, msg *Message) {
+	if c.media != models.MediaSFU {
+		c.sendError(40006, "房间未启用 SFU")
+		return
+	}
+
+	err := sfuManager.Join(c.roomID, c.sessionID, c.stream, sfuSignal(c))
+	if err != nil {
+		c.sendError(50001, "加入 SFU 失败")
+		log.Printf("加入 SFU 失败: %v", err)
+		return
+	}
+	// 加入期间连接已关闭，cleanupWith 可能已经先执行了 leaveSFU
+	select {
+	case <-c.done:
+		leaveSFU(c)
+		return
+	default:
+	}
+	// 首个 offer 尚未被回复，此时还没有上行音频
+	if c.forceMuted.Load() {
+		sfuManager.SetMuted(c.roomID, c.sessionID, true)
+	}
+}
+
+// 处理发给服务端（to 为空）的信令
+func handleSFUSignal(c *Client, msg *Message) {
+	var err error
+	switch msg.Type {
+	case MsgAnswer:
+		var answer webrtc.SessionDescription
+		if err = json.Unmarshal(msg.Data, &answer); err != nil {
+			c.sendError(40001, "消息格式错误")
+			return
+		}
+		err = sfuManager.Answer(c.roomID, c.sessionID, answer)
+	case MsgCandidate:
+		var candidate webrtc.ICECandidateInit
+		if err = json.Unmarshal(msg.Data, &candidate); err != nil {
+			c.sendError(40001, "消息格式错误")
+			return
+		}
+		err = sfuManager.Candidate(c.roomID, c.sessionID, candidate)
+	default:
+		c.sendError(40007, "SFU 只接受 answer 和 candidate")
+		return
+	}
+
+	if err == sfu.ErrPeerNotFound {
+		c.sendError(40008, "尚未加入 SFU")
+	} else if err != nil {
+		c.sendError(40001, "信令处理失败")
+		log.Printf("SFU 信令处理失败: %v", err)
+	}
+}
+
+// 发给客户端的 SFU 信令
+func sfuSignal(c *Client) sfu.SignalFunc {
+	return func(kind string, payload interface{}) {
+		signal, err := newMessage(kind, "", payload)
+		if err != nil {
+			log.Printf("序列化 SFU 信令失败: %v", err)
+			return
+		}
+		c.sendMessage(signal)
+	}
+}
+
+// 恢复会话后 SFU 信令改发到新连接，尚未加入 SFU 时忽略
+func rebindSFU(c *Client) {
+	sfuManager.Rebind(c.roomID, c.sessionID, sfuSignal(c))
+}
+
+func leaveSFU(c *Client) {
+	sfuManager.Leave(c.roomID, c.sessionID)
+}
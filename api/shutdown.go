@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// 服务关闭：断开所有 WebSocket 连接并等待读写 goroutine 和实例间转发结束。
+// 客户端先收到 reconnect 消息，随后连接以 1001 关闭，应在 retry_after 毫秒后重新调用 /room/join；
+// 多实例部署时负载均衡会把它分配到其他实例。
+
+// 重连等待时间的范围（毫秒），随机分散，避免所有客户端同时重连
+const (
+	reconnectMinDelay = 1000
+	reconnectMaxDelay = 5000
+)
+
+var (
+	closing atomic.Bool    // 为 true 时不再接受新的 WebSocket 连接
+	pumps   sync.WaitGroup // 运行中的 readPump、writePump
+	relays  sync.WaitGroup // 运行中的房间发布 goroutine，见 room.joinCluster
+)
+
+type reconnectData struct {
+	RetryAfter int `json:"retry_after"` // 建议等待的毫秒数
+}
+
+// 启动连接的读写 goroutine
+func (c *Client) start() {
+	pumps.Add(2)
+	go c.readPump()
+	go c.writePump()
+}
+
+// 只启动写 goroutine，用于发出错误消息和关闭帧后结束的连接
+func (c *Client) startWriter() {
+	pumps.Add(1)
+	go c.writePump()
+}
+
+// 断开所有连接并等待其退出，ctx 到期时返回 ctx.Err()。应在 HTTP 服务停止接受新请求后调用。
+func Shutdown(ctx context.Context) error {
+	closing.Store(true)
+	expiry.stop()
+
+	clients := Hub.clients()
+	var left sync.WaitGroup
+	for _, client := range clients {
+		msg, _ := newMessage(MsgReconnect, "", reconnectData{
+			RetryAfter: reconnectMinDelay + rand.Intn(reconnectMaxDelay-reconnectMinDelay),
+		})
+		client.sendMessage(msg)
+
+		left.Add(1)
+		go func(client *Client) {
+			defer left.Done()
+			// 离开房间会通知其他实例，并结束录音
+			client.cleanupWith(websocket.CloseGoingAway, "服务器正在重启，请重新连接")
+		}(client)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		left.Wait()
+		pumps.Wait()
+		relays.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 本实例上所有房间的所有连接，包括等待恢复的会话
+func (h *RoomHub) clients() []*Client {
+	var rooms []*room
+	for i := range h.shards {
+		s := &h.shards[i]
+		s.lock.Lock()
+		for _, r := range s.rooms {
+			rooms = append(rooms, r)
+		}
+		s.lock.Unlock()
+	}
+
+	var clients []*Client
+	for _, r := range rooms {
+		r.do(func(r *room) {
+			for _, peer := range r.members {
+				clients = append(clients, peer)
+			}
+		})
+	}
+	return clients
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+
+	"talkFlow/models"
+)
+
+// WebRTC 信令：服务端只负责在同房间成员之间转发，不解析 SDP 和 ICE 候选内容
+const (
+	MsgOffer     = "offer"     // data: RTCSessionDescriptionInit
+	MsgAnswer    = "answer"    // data: RTCSessionDescriptionInit
+	MsgCandidate = "candidate" // data: RTCIceCandidateInit
+)
+
+func init() {
+	registerHandler(MsgOffer, handleSignal)
+	registerHandler(MsgAnswer, handleSignal)
+	registerHandler(MsgCandidate, handleSignal)
+}
+
+func handleSignal(c *Client, msg *Message) {
+	// SFU 房间中 to 为空表示发给服务端
+	if msg.To == "" && c.media == models.MediaSFU {
+		handleSFUSignal(c, msg)
+		return
+	}
+	if msg.To == "" || msg.To == c.userID || msg.To == c.sessionID {
+		c.sendError(40005, "缺少信令接收者")
+		return
+	}
+	if len(msg.Data) == 0 || !json.Valid(msg.Data) {
+		c.sendError(40001, "消息格式错误")
+		return
+	}
+
+	frame, err := msg.frame()
+	if err != nil {
+		return
+	}
+	if !Hub.sendTo(c.roomID, msg.To, frame) {
+		c.sendError(40404, "目标成员不在房间内")
+	}
+}
+
+// 发送给房间内指定成员，to 可以是访客ID（该访客的所有连接）或会话ID，成员不存在时返回 false
+func (h *RoomHub) sendTo(roomID, to string, msg outbound) bool {
+	found := false
+	h.do(roomID, func(r *room) {
+		for sid, peer := range r.members {
+			if peer.userID == to || sid == to {
+				found = true
+				peer.enqueue(msg)
+			}
+		}
+		if r.hasRemote(to) {
+			found = true
+			r.relay(clusterEvent{Type: clusterDirect, Kind: msg.kind, To: to}, msg.data)
+		}
+	})
+	return found
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -12,52 +13,89 @@ import (
 
 	"talkFlow/config"
 	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-type Client struct {
-	conn   *websocket.Conn
-	roomID string
-	userID string
-	send   chan []byte
-	once   sync.Once // 新增
-}
-
-type RoomHub struct {
-	rooms map[string]map[string]*Client
-	lock  sync.Mutex
+// 按配置开启 permessage-deflate（main 启动时调用一次即可）
+func InitWebSocket() {
+	upgrader.EnableCompression = config.WSCompression
 }
 
-var Hub = RoomHub{
-	rooms: make(map[string]map[string]*Client),
+type Client struct {
+	conn       *websocket.Conn
+	roomID     string
+	roomDBID   int64 // rooms 表主键
+	room       *room // 所在房间，加入后不再变化
+	userID     string
+	sessionID  string        // 连接会话ID，每条连接唯一
+	stream     string        // 音频流ID，用于 SFU 轨道和录音文件，多设备模式下带上会话ID
+	name       string        // 显示昵称
+	ip         string        // 连接来源IP，用于按IP封禁
+	host       bool          // 是否房主，可以执行管理操作
+	joinedAt   time.Time     // 加入房间时间
+	media      string        // 房间音频模式，见 models.MediaMesh / models.MediaSFU
+	muted      atomic.Bool   // 是否静音
+	forceMuted atomic.Bool   // 是否被房主禁言，禁言期间不转发其音频
+	evicted    atomic.Bool   // 已被房间移除（被新连接替换或房间关闭），离开时仍需释放音频资源
+	resumeKey  string        // 恢复会话用的令牌，每次连接重新生成
+	grace      *time.Timer   // 断线后等待恢复的定时器，只在房间 goroutine 中访问
+	send       chan outbound // 控制消息发送队列，不会被关闭
+	audio      chan outbound // 音频发送队列，满时按 config.SlowConsumerPolicy 丢弃
+	stats      clientStats
+	slow       atomic.Bool   // 已因发送队列过慢断开，见 disconnectSlow
+	done       chan struct{} // 连接结束时关闭
+	once       sync.Once
+	closeMsg   []byte // 关闭帧内容，在 done 关闭前写入
 }
 
 // 创建 WebSocket 连接
 func TalkHandler(c *gin.Context) {
+	if closing.Load() {
+		c.JSON(503, gin.H{"code": 50301, "error": "服务正在重启，请稍后重试"})
+		return
+	}
 	roomID := c.Query("join_code")
-	userID := c.Query("id")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// 查询房间信息到 room 结构体
-	var room models.Room
-	roomSQL := `SELECT id, creater, name, joiner, join_code, create_time, expire_time, status, ip FROM rooms WHERE join_code = ?`
-	err := config.DB.QueryRowContext(ctx, roomSQL, roomID).Scan(
-		&room.ID,
-		&room.Creater,
-		&room.Name,
-		&room.JoinerStr, // 先用字符串接收
-		&room.JoinCode,
-		&room.CreateTime,
-		&room.ExpireTime,
-		&room.Status,
-		&room.IP,
-	)
+	// 访客ID在凭证中，这里只按IP限制
+	if _, ok := checkJoinLimit(ctx, c, ""); !ok {
+		return
+	}
+
+	if key := c.Query("resume"); key != "" {
+		resumeSession(c, roomID, key)
+		return
+	}
+
+	// 入场凭证由 JoinRoom 签发，访客ID以凭证中的为准
+	claims, err := utils.ParseRoomTicket(c.Query("ticket"))
+	if err != nil {
+		c.JSON(401, gin.H{
+			"code":  40102,
+			"error": "入场凭证无效或已过期",
+		})
+		log.Println("入场凭证无效:", c.ClientIP())
+		return
+	}
+	userID := claims.VisitorID
+
+	// 凭证与房间不匹配时同样回复房间不存在，避免用已有的凭证探测其他加入码
+	room, err := config.Store.Rooms.GetByJoinCode(ctx, roomID)
+	if err == nil && claims.RoomID != room.ID {
+		log.Println("入场凭证与房间不匹配:", roomID)
+		err = store.ErrNotFound
+	}
 	if err != nil {
+		if err == store.ErrNotFound {
+			recordJoinMiss(ctx, c, models.JoinSourceWebSocket, roomID, userID)
+		}
 		c.JSON(404, gin.H{
 			"code":  40401,
 			"error": "房间不存在",
@@ -65,6 +103,51 @@ func TalkHandler(c *gin.Context) {
 		log.Println("房间不存在:", roomID)
 		return
 	}
+	if !room.IsOngoing() {
+		c.JSON(400, gin.H{
+			"code":  40002,
+			"error": "房间已结束",
+		})
+		log.Println("房间已结束:", room.ID)
+		return
+	}
+	if room.Locked && !claims.Host {
+		c.JSON(403, gin.H{"code": 40305, "error": "房间已锁定"})
+		return
+	}
+	if !claims.Host {
+		banned, err := config.Store.Bans.IsBanned(ctx, room.ID, userID, c.ClientIP())
+		if err != nil {
+			c.JSON(500, gin.H{"code": 50002, "error": "查询封禁记录失败"})
+			log.Println("查询封禁记录失败:", err)
+			return
+		}
+		if banned {
+			c.JSON(403, gin.H{"code": 40304, "error": "已被禁止加入该房间"})
+			return
+		}
+	}
+
+	if config.SessionPolicy == config.SessionReject && Hub.member(roomID, userID) != nil {
+		c.JSON(409, gin.H{"code": 40905, "error": "该访客已在房间内"})
+		return
+	}
+
+	sessionID, err := utils.RandomToken(8)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50001, "error": "生成会话ID失败"})
+		return
+	}
+	resumeKey, err := newResumeKey()
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50001, "error": "生成会话ID失败"})
+		return
+	}
+	stream := userID
+	if config.SessionPolicy == config.SessionMulti {
+		stream = userID + "/" + sessionID
+	}
+
 	// 升级为 WebSocket
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -76,28 +159,58 @@ func TalkHandler(c *gin.Context) {
 		return
 	}
 
+	name := claims.Name
+	if name == "" {
+		name = userID
+	}
+
 	client := &Client{
-		conn:   conn,
-		roomID: roomID,
-		userID: userID,
-		send:   make(chan []byte, 256),
+		conn:      conn,
+		roomID:    roomID,
+		roomDBID:  room.ID,
+		userID:    userID,
+		sessionID: sessionID,
+		stream:    stream,
+		name:      name,
+		ip:        c.ClientIP(),
+		host:      claims.Host,
+		joinedAt:  time.Now(),
+		media:     room.MediaMode,
+		resumeKey: resumeKey,
+		send:      make(chan outbound, 256),
+		audio:     make(chan outbound, 256),
+		done:      make(chan struct{}),
 	}
 
-	// 添加到房间
-	Hub.lock.Lock()
-	if Hub.rooms[roomID] == nil {
-		Hub.rooms[roomID] = make(map[string]*Client)
+	client.sendMessage(client.hello(false))
+
+	// 添加到房间并广播 join 事件
+	replaced, ok := Hub.join(client)
+	if !ok {
+		// 预检查之后同一访客抢先加入
+		client.sendError(40905, "该访客已在房间内")
+		client.cleanupWith(websocket.ClosePolicyViolation, "该访客已在房间内")
+		client.startWriter()
+		return
+	}
+	if replaced != nil {
+		// 新连接开始收发之前结束旧连接，保证旧连接的录音文件和音频轨道先被关闭
+		replaced.cleanupWith(websocket.CloseNormalClosure, "已在其他连接中加入房间")
+	}
+	expiry.schedule(room.ID, roomID, room.ExpireTime)
+
+	if activeRecorder(roomID) != nil {
+		notice, _ := newMessage(MsgRecording, "", recordingData{Active: true})
+		client.sendMessage(notice)
 	}
-	Hub.rooms[roomID][userID] = client
-	Hub.lock.Unlock()
 
-	go client.readPump()
-	go client.writePump()
+	client.start()
 }
 
-// 读取消息并广播
+// 读取消息：文本帧按控制消息分发，二进制帧作为音频广播
 func (c *Client) readPump() {
-	defer c.cleanup()
+	defer pumps.Done()
+	defer c.disconnect()
 
 	c.conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
 	c.conn.SetPongHandler(func(string) error {
@@ -106,39 +219,64 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		msgType, message, err := c.conn.ReadMessage()
 		if err != nil {
 			println("readPump exit:", err.Error())
 			break
 		}
-		// 忽略心跳
-		if string(message) == "ping" {
-			continue
+		switch msgType {
+		case websocket.TextMessage:
+			// 兼容旧版客户端的纯文本心跳
+			if string(message) == "ping" {
+				continue
+			}
+			Hub.dispatch(c, message)
+		case websocket.BinaryMessage:
+			if c.forceMuted.Load() {
+				continue
+			}
+			if rec := activeRecorder(c.roomID); rec != nil {
+				rec.writeWebM(c.stream, message)
+			}
+			c.broadcastToRoom(outbound{kind: websocket.BinaryMessage, data: message}, false)
 		}
-		c.broadcastToRoom(message)
 	}
 }
 
 // 写消息到客户端
 func (c *Client) writePump() {
+	defer pumps.Done()
 	ticker := time.NewTicker(30 * time.Second)
 	defer func() {
 		ticker.Stop()
-		c.cleanup()
+		c.conn.Close()
+		c.disconnect()
 	}()
 
 	for {
+		// 控制消息优先于音频发送
 		select {
-		case msg, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, nil)
+		case msg := <-c.send:
+			if !c.write(msg) {
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
-				println("writePump write error:", err.Error())
+			continue
+		default:
+		}
+
+		select {
+		case msg := <-c.send:
+			if !c.write(msg) {
 				return
 			}
+		case msg := <-c.audio:
+			if !c.write(msg) {
+				return
+			}
+		case <-c.done:
+			c.flush()
+			c.conn.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(time.Second))
+			return
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -148,39 +286,143 @@ func (c *Client) writePump() {
 	}
 }
 
-// 广播消息到同房间用户
-func (c *Client) broadcastToRoom(msg []byte) {
-	Hub.lock.Lock()
-	defer Hub.lock.Unlock()
-
-	for uid, peer := range Hub.rooms[c.roomID] {
-		if uid != c.userID {
-			select {
-			case peer.send <- msg:
-			default:
-				go peer.cleanup()
+func (c *Client) write(msg outbound) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := c.writeFrame(msg); err != nil {
+		println("writePump write error:", err.Error())
+		return false
+	}
+	return true
+}
+
+func (c *Client) writeFrame(msg outbound) error {
+	// 只压缩控制消息，音频本身已经是压缩格式；未协商压缩时不生效
+	c.conn.EnableWriteCompression(msg.kind == websocket.TextMessage)
+	if msg.prepared != nil {
+		return c.conn.WritePreparedMessage(msg.prepared)
+	}
+	return c.conn.WriteMessage(msg.kind, msg.data)
+}
+
+// 连接关闭前尽量发出队列中剩余的控制消息（如 kick 通知）
+func (c *Client) flush() {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.writeFrame(msg); err != nil {
+				return
 			}
+		default:
+			return
 		}
 	}
 }
 
+// 投递一帧到发送队列：音频按慢速客户端策略处理，控制消息队列满时断开该连接（可以恢复会话）
+func (c *Client) enqueue(msg outbound) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	if msg.kind == websocket.BinaryMessage {
+		return c.enqueueAudio(msg)
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.disconnectSlow()
+		return false
+	}
+}
+
+// 发送控制消息给自己
+func (c *Client) sendMessage(msg *Message) {
+	frame, err := msg.frame()
+	if err != nil {
+		log.Printf("序列化消息失败: %v", err)
+		return
+	}
+	c.enqueue(frame)
+}
+
+func (c *Client) sendError(code int, text string) {
+	msg, _ := newMessage(MsgError, "", errorData{Code: code, Error: text})
+	c.sendMessage(msg)
+}
+
+// 广播控制消息到同房间用户，includeSelf 为 true 时发送者也会收到
+func (c *Client) broadcastMessage(msg *Message, includeSelf bool) {
+	exclude := c.sessionID
+	if includeSelf {
+		exclude = ""
+	}
+	c.room.publish(msg, exclude)
+}
+
+// 广播消息到同房间用户
+func (c *Client) broadcastToRoom(msg outbound, includeSelf bool) {
+	exclude := c.sessionID
+	if includeSelf {
+		exclude = ""
+	}
+	c.room.send(msg, exclude)
+}
+
 // 清理连接资源
 func (c *Client) cleanup() {
-	c.once.Do(func() { // 保证只执行一次
-		c.conn.Close()
-		Hub.lock.Lock()
-		defer Hub.lock.Unlock()
+	c.cleanupWith(websocket.CloseNormalClosure, "")
+}
 
-		if _, ok := Hub.rooms[c.roomID]; ok {
-			delete(Hub.rooms[c.roomID], c.userID)
-			if len(Hub.rooms[c.roomID]) == 0 {
-				delete(Hub.rooms, c.roomID)
-			}
-		}
-		close(c.send)
+// 带关闭原因清理连接并离开房间，关闭帧由 writePump 发出
+func (c *Client) cleanupWith(code int, reason string) {
+	c.closeConn(code, reason)
+	c.leaveRoom()
+}
+
+// 关闭连接但不离开房间，可重复调用
+func (c *Client) closeConn(code int, reason string) {
+	c.once.Do(func() { // 保证只执行一次
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		// 先关闭 done 再释放 SFU，之后完成的 sfu_join 会自行退出，见 handleSFUJoin
+		close(c.done)
 	})
 }
 
+// 连接意外断开：支持恢复会话时保留成员身份等待重连，否则直接离开房间
+func (c *Client) disconnect() {
+	c.disconnectWith(websocket.CloseNormalClosure, "")
+}
+
+func (c *Client) disconnectWith(code int, reason string) {
+	if config.ResumeGrace == 0 {
+		c.cleanupWith(code, reason)
+		return
+	}
+	c.closeConn(code, reason)
+	if !Hub.suspend(c) {
+		c.leaveRoom()
+	}
+}
+
+// 离开房间并释放音频资源
+func (c *Client) leaveRoom() {
+	left := Hub.leave(c)
+
+	release := left.removed || c.evicted.Load()
+	if release && c.media == models.MediaSFU {
+		leaveSFU(c)
+	}
+	// 房间没人时自动结束录音
+	if left.empty {
+		stopRecording(c.roomID)
+	} else if rec := activeRecorder(c.roomID); release && rec != nil {
+		rec.closeTrack(c.stream)
+	}
+}
+
 func TestWSHandler(c *gin.Context) {
 	log.Println("收到 WebSocket 测试连接请求")
 
@@ -209,36 +451,3 @@ func TestWSHandler(c *gin.Context) {
 		}
 	}
 }
-
-// 定时清理已过期房间（main 启动时调用一次即可）
-func StartRoomCleaner() {
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-
-			Hub.lock.Lock()
-			for roomID, users := range Hub.rooms {
-				func() {
-					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-					defer cancel()
-
-					// 查询房间的过期时间和状态
-					var expireTime time.Time
-					var status int
-					query := `SELECT expire_time, status FROM rooms WHERE join_code = ?`
-					err := config.DB.QueryRowContext(ctx, query, roomID).Scan(&expireTime, &status)
-
-					// 如果查不到房间、房间已结束或已过期，则关闭所有连接并移除房间
-					if err != nil || status != int(models.RoomOngoing) || expireTime.Before(time.Now()) {
-						for _, client := range users {
-							client.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "房间已过期或已结束"))
-							client.conn.Close()
-						}
-						delete(Hub.rooms, roomID)
-					}
-				}()
-			}
-			Hub.lock.Unlock()
-		}
-	}()
-}
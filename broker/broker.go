@@ -0,0 +1,19 @@
+// Package broker 在多个 talkFlow 实例之间转发房间消息。
+//
+// 每个房间对应一个频道，实例上有成员在线时订阅该房间，房间内的音频、控制消息和成员变化都会发布到频道，
+// 其他实例收到后转发给各自的成员。消息内容由调用方编码，broker 只负责投递，投递语义为至多一次。
+package broker
+
+import "context"
+
+// 收到频道消息时回调，payload 在回调返回后不会被复用；回调不能阻塞
+type Handler func(payload []byte)
+
+type Broker interface {
+	// 发布到房间频道，订阅了该房间的其他实例都会收到，返回收到消息的订阅数。
+	// Redis 实现会把消息投递回自己的订阅（并计入订阅数），调用方需要自行忽略；内存实现不会
+	Publish(ctx context.Context, room string, payload []byte) (int, error)
+	// 订阅房间频道，返回取消订阅的函数
+	Subscribe(ctx context.Context, room string, handler Handler) (unsubscribe func(), err error)
+	Close() error
+}
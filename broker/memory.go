@@ -0,0 +1,105 @@
+package broker
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// 每个订阅的待投递队列长度，满时丢弃新消息
+const memoryQueue = 1024
+
+// 进程内实现，只有一个实例时使用。NewMemoryCluster 可以在同一进程中模拟多个实例互相通信。
+// 发布的消息不会投递回同一个 broker 上的订阅，单实例部署时 Publish 不投递给任何订阅。
+type memoryBroker struct {
+	bus *memoryBus
+}
+
+// 多个 memoryBroker 共用的订阅表
+type memoryBus struct {
+	mu   sync.Mutex
+	subs map[string]map[*memorySub]struct{}
+}
+
+type memorySub struct {
+	owner *memoryBroker // 订阅所在的实例，不投递该实例自己发布的消息
+	queue chan []byte
+	done  chan struct{}
+}
+
+func NewMemory() Broker {
+	return NewMemoryCluster(1)[0]
+}
+
+// 创建 n 个共用同一订阅表的 broker，每个相当于一个实例
+func NewMemoryCluster(n int) []Broker {
+	bus := &memoryBus{subs: make(map[string]map[*memorySub]struct{})}
+	brokers := make([]Broker, n)
+	for i := range brokers {
+		brokers[i] = &memoryBroker{bus: bus}
+	}
+	return brokers
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, room string, payload []byte) (int, error) {
+	b.bus.mu.Lock()
+	defer b.bus.mu.Unlock()
+
+	n := 0
+	for sub := range b.bus.subs[room] {
+		if sub.owner == b {
+			continue
+		}
+		n++
+		select {
+		case sub.queue <- payload:
+		default:
+			log.Printf("broker: 房间 %s 的订阅者处理过慢，丢弃消息", room)
+		}
+	}
+	return n, nil
+}
+
+func (b *memoryBroker) Subscribe(ctx context.Context, room string, handler Handler) (func(), error) {
+	sub := &memorySub{
+		owner: b,
+		queue: make(chan []byte, memoryQueue),
+		done:  make(chan struct{}),
+	}
+
+	b.bus.mu.Lock()
+	if b.bus.subs[room] == nil {
+		b.bus.subs[room] = make(map[*memorySub]struct{})
+	}
+	b.bus.subs[room][sub] = struct{}{}
+	b.bus.mu.Unlock()
+
+	// 每个订阅单独投递，回调慢只影响自己
+	go func() {
+		for {
+			select {
+			case payload := <-sub.queue:
+				handler(payload)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.bus.mu.Lock()
+			delete(b.bus.subs[room], sub)
+			if len(b.bus.subs[room]) == 0 {
+				delete(b.bus.subs, room)
+			}
+			b.bus.mu.Unlock()
+			close(sub.done)
+		})
+	}, nil
+}
+
+func (b *memoryBroker) Close() error {
+	return nil
+}
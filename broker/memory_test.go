@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemoryPublishSkipsSelf(t *testing.T) {
+	b := NewMemory()
+	room := testRoom(t)
+	ch, unsubscribe := subscribeChan(t, b, room)
+	defer unsubscribe()
+
+	// 单实例时没有其他订阅者，自己发布的消息不会回到自己
+	n, err := b.Publish(context.Background(), room, []byte("self"))
+	if err != nil || n != 0 {
+		t.Fatalf("Publish = %d, %v，期望 0", n, err)
+	}
+	expectNothing(t, ch)
+}
+
+func TestMemoryClusterDelivers(t *testing.T) {
+	nodes := NewMemoryCluster(3)
+	room := testRoom(t)
+	ch1, unsubscribe1 := subscribeChan(t, nodes[1], room)
+	ch2, unsubscribe2 := subscribeChan(t, nodes[2], room)
+	defer unsubscribe2()
+	self, unsubscribe0 := subscribeChan(t, nodes[0], room)
+	defer unsubscribe0()
+
+	n, err := nodes[0].Publish(context.Background(), room, []byte("hello"))
+	if err != nil || n != 2 {
+		t.Fatalf("Publish = %d, %v，期望 2", n, err)
+	}
+	expectPayload(t, ch1, []byte("hello"))
+	expectPayload(t, ch2, []byte("hello"))
+	expectNothing(t, self)
+
+	unsubscribe1()
+	unsubscribe1() // 重复调用无效
+	if n, _ := nodes[0].Publish(context.Background(), room, []byte("again")); n != 1 {
+		t.Fatalf("取消订阅后 Publish = %d，期望 1", n)
+	}
+	expectPayload(t, ch2, []byte("again"))
+	expectNothing(t, ch1)
+}
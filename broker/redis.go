@@ -0,0 +1,133 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis 频道名前缀，频道名为前缀加邀请码
+const redisChannelPrefix = "talkflow:room:"
+
+// 基于 Redis pub/sub 的实现，多个实例连接同一个 Redis 即可互相转发房间消息。
+// 所有房间共用一条订阅连接，按需增减订阅的频道。
+type redisBroker struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	// 串行化对 Redis 的订阅和取消订阅，保证同一频道的 SUBSCRIBE 和 UNSUBSCRIBE 按顺序发出；会跨网络调用持有
+	subMu sync.Mutex
+	// 保护 subs，只在内存中短暂持有，dispatch 不会被网络调用阻塞
+	mu   sync.Mutex
+	subs map[string]map[*redisSub]struct{} // 按频道名索引
+}
+
+type redisSub struct {
+	handler Handler
+}
+
+// 连接 REDIS_URL 格式的地址，如 redis://:password@localhost:6379/0
+func NewRedis(url string) (Broker, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("解析 Redis 地址失败: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+
+	b := &redisBroker{
+		client: client,
+		pubsub: client.Subscribe(context.Background()),
+		subs:   make(map[string]map[*redisSub]struct{}),
+	}
+	go b.dispatch()
+	return b, nil
+}
+
+// 将订阅连接收到的消息交给对应频道的回调，连接断开时 go-redis 会自动重连并重新订阅
+func (b *redisBroker) dispatch() {
+	for msg := range b.pubsub.Channel() {
+		b.mu.Lock()
+		handlers := make([]Handler, 0, len(b.subs[msg.Channel]))
+		for sub := range b.subs[msg.Channel] {
+			handlers = append(handlers, sub.handler)
+		}
+		b.mu.Unlock()
+
+		payload := []byte(msg.Payload)
+		for _, handler := range handlers {
+			handler(payload)
+		}
+	}
+}
+
+func (b *redisBroker) Publish(ctx context.Context, room string, payload []byte) (int, error) {
+	n, err := b.client.Publish(ctx, redisChannelPrefix+room, payload).Result()
+	return int(n), err
+}
+
+func (b *redisBroker) Subscribe(ctx context.Context, room string, handler Handler) (func(), error) {
+	channel := redisChannelPrefix + room
+	sub := &redisSub{handler: handler}
+
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	b.mu.Lock()
+	first := len(b.subs[channel]) == 0
+	b.mu.Unlock()
+	if first {
+		if err := b.pubsub.Subscribe(ctx, channel); err != nil {
+			return nil, err
+		}
+	}
+
+	b.mu.Lock()
+	if b.subs[channel] == nil {
+		b.subs[channel] = make(map[*redisSub]struct{})
+	}
+	b.subs[channel][sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(channel, sub) })
+	}, nil
+}
+
+func (b *redisBroker) unsubscribe(channel string, sub *redisSub) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	b.mu.Lock()
+	delete(b.subs[channel], sub)
+	last := len(b.subs[channel]) == 0
+	if last {
+		delete(b.subs, channel)
+	}
+	b.mu.Unlock()
+	if !last {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.pubsub.Unsubscribe(ctx, channel); err != nil {
+		log.Printf("broker: 取消订阅 %s 失败: %v", channel, err)
+	}
+}
+
+func (b *redisBroker) Close() error {
+	b.pubsub.Close()
+	return b.client.Close()
+}
@@ -0,0 +1,362 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 设置后测试连接真实的 Redis，如 redis://localhost:6379/15；否则使用下面只实现 pub/sub 的假服务端
+const testRedisEnv = "TALKFLOW_TEST_REDIS_URL"
+
+// 只支持 go-redis 连接和 pub/sub 用到的命令（RESP2），记录收到的订阅命令便于检查
+type fakeRedis struct {
+	ln net.Listener
+
+	mu           sync.Mutex
+	subs         map[string]map[*fakeConn]bool // 按频道索引的订阅连接
+	subscribes   map[string]int                // 每个频道收到的 SUBSCRIBE 次数
+	unsubscribes map[string]int
+}
+
+type fakeConn struct {
+	net.Conn
+	wmu      sync.Mutex
+	channels map[string]bool // 由 fakeRedis.mu 保护
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{
+		ln:           ln,
+		subs:         make(map[string]map[*fakeConn]bool),
+		subscribes:   make(map[string]int),
+		unsubscribes: make(map[string]int),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(&fakeConn{Conn: conn, channels: make(map[string]bool)})
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) url() string {
+	return "redis://" + s.ln.Addr().String() + "/0"
+}
+
+func (s *fakeRedis) serve(c *fakeConn) {
+	defer func() {
+		s.mu.Lock()
+		for ch := range c.channels {
+			delete(s.subs[ch], c)
+		}
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.handle(c, args)
+	}
+}
+
+func (s *fakeRedis) handle(c *fakeConn, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		if len(c.channels) > 0 {
+			c.write(array(bulk("pong"), bulk("")))
+		} else {
+			c.write("+PONG\r\n")
+		}
+	case "PUBSUB": // 只支持 NUMSUB
+		var items []string
+		for _, ch := range args[2:] {
+			items = append(items, bulk(ch), integer(len(s.subs[ch])))
+		}
+		c.write(array(items...))
+	case "PUBLISH":
+		n := 0
+		for peer := range s.subs[args[1]] {
+			peer.write(array(bulk("message"), bulk(args[1]), bulk(args[2])))
+			n++
+		}
+		c.write(integer(n))
+	case "SUBSCRIBE":
+		for _, ch := range args[1:] {
+			if s.subs[ch] == nil {
+				s.subs[ch] = make(map[*fakeConn]bool)
+			}
+			s.subs[ch][c] = true
+			c.channels[ch] = true
+			s.subscribes[ch]++
+			c.write(array(bulk("subscribe"), bulk(ch), integer(len(c.channels))))
+		}
+	case "UNSUBSCRIBE":
+		for _, ch := range args[1:] {
+			delete(s.subs[ch], c)
+			delete(c.channels, ch)
+			s.unsubscribes[ch]++
+			c.write(array(bulk("unsubscribe"), bulk(ch), integer(len(c.channels))))
+		}
+	default:
+		// HELLO、CLIENT SETINFO 等：go-redis 收到错误后按 RESP2 继续
+		c.write("-ERR unknown command '" + args[0] + "'\r\n")
+	}
+}
+
+func (c *fakeConn) write(reply string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	io.WriteString(c, reply)
+}
+
+// 读取一条由 bulk string 组成的命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("无法解析的命令: %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("无法解析的参数: %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func bulk(s string) string { return "$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n" }
+
+func integer(n int) string { return ":" + strconv.Itoa(n) + "\r\n" }
+
+func array(items ...string) string {
+	return "*" + strconv.Itoa(len(items)) + "\r\n" + strings.Join(items, "")
+}
+
+func (s *fakeRedis) counts(room string) (subscribes, unsubscribes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribes[redisChannelPrefix+room], s.unsubscribes[redisChannelPrefix+room]
+}
+
+// 返回 Redis 地址；使用假服务端时同时返回它，真实 Redis 时为 nil
+func testRedis(t *testing.T) (string, *fakeRedis) {
+	if url := os.Getenv(testRedisEnv); url != "" {
+		return url, nil
+	}
+	s := startFakeRedis(t)
+	return s.url(), s
+}
+
+func newTestRedis(t *testing.T, url string) *redisBroker {
+	t.Helper()
+	b, err := NewRedis(url)
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b.(*redisBroker)
+}
+
+// 每个测试使用不同的房间名，连接真实 Redis 时互不干扰
+func testRoom(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+func subscribeChan(t *testing.T, b Broker, room string) (<-chan []byte, func()) {
+	t.Helper()
+	ch := make(chan []byte, 64)
+	unsubscribe, err := b.Subscribe(context.Background(), room, func(payload []byte) { ch <- payload })
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	return ch, unsubscribe
+}
+
+func expectPayload(t *testing.T, ch <-chan []byte, want []byte) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if !bytes.Equal(got, want) {
+			t.Fatalf("收到 %q，期望 %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("没有收到 %q", want)
+	}
+}
+
+func expectNothing(t *testing.T, ch <-chan []byte) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		t.Fatalf("不应收到消息，收到 %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// SUBSCRIBE 和 UNSUBSCRIBE 由 go-redis 异步确认，等待频道在 Redis 上的订阅连接数变为 n
+func waitSubscribers(t *testing.T, b *redisBroker, room string, n int64) {
+	t.Helper()
+	channel := redisChannelPrefix + room
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		counts, err := b.client.PubSubNumSub(context.Background(), channel).Result()
+		if err != nil {
+			t.Fatalf("PUBSUB NUMSUB: %v", err)
+		}
+		if counts[channel] == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("频道 %s 的订阅连接数为 %d，期望 %d", room, counts[channel], n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisPublishSubscribe(t *testing.T) {
+	url, _ := testRedis(t)
+	a, b := newTestRedis(t, url), newTestRedis(t, url)
+	room := testRoom(t)
+
+	ch, unsubscribe := subscribeChan(t, b, room)
+	defer unsubscribe()
+	waitSubscribers(t, a, room, 1)
+
+	// 实例间消息是 JSON 头加换行加二进制帧，必须原样送达
+	payload := []byte("{\"node\":\"a\"}\n\x00\x01\xff")
+	n, err := a.Publish(context.Background(), room, payload)
+	if err != nil || n != 1 {
+		t.Fatalf("Publish = %d, %v", n, err)
+	}
+	expectPayload(t, ch, payload)
+
+	// 其他房间的消息收不到
+	if _, err := a.Publish(context.Background(), room+"-other", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	expectNothing(t, ch)
+}
+
+// 同一实例上同一房间的多个订阅共用一次 SUBSCRIBE，最后一个取消时才 UNSUBSCRIBE
+func TestRedisSharedSubscription(t *testing.T) {
+	url, fake := testRedis(t)
+	a, b := newTestRedis(t, url), newTestRedis(t, url)
+	room := testRoom(t)
+
+	ch1, unsubscribe1 := subscribeChan(t, b, room)
+	ch2, unsubscribe2 := subscribeChan(t, b, room)
+	waitSubscribers(t, a, room, 1)
+
+	a.Publish(context.Background(), room, []byte("one"))
+	expectPayload(t, ch1, []byte("one"))
+	expectPayload(t, ch2, []byte("one"))
+
+	unsubscribe1()
+	unsubscribe1() // 重复调用无效
+	a.Publish(context.Background(), room, []byte("two"))
+	expectPayload(t, ch2, []byte("two"))
+	expectNothing(t, ch1)
+
+	unsubscribe2()
+	waitSubscribers(t, a, room, 0)
+	if fake != nil {
+		if subs, unsubs := fake.counts(room); subs != 1 || unsubs != 1 {
+			t.Fatalf("SUBSCRIBE %d 次、UNSUBSCRIBE %d 次，期望各 1 次", subs, unsubs)
+		}
+	}
+}
+
+// 订阅和取消订阅交错进行时，Redis 上的订阅状态要和本地一致
+func TestRedisSubscribeChurn(t *testing.T) {
+	url, _ := testRedis(t)
+	a, b := newTestRedis(t, url), newTestRedis(t, url)
+	base := testRoom(t)
+	rooms := []string{base + "-0", base + "-1", base + "-2"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				unsubscribe, err := b.Subscribe(context.Background(), rooms[(i+n)%len(rooms)], func([]byte) {})
+				if err != nil {
+					t.Errorf("Subscribe: %v", err)
+					return
+				}
+				unsubscribe()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, room := range rooms {
+		waitSubscribers(t, a, room, 0)
+	}
+
+	// 交错之后重新订阅仍然有效
+	ch, unsubscribe := subscribeChan(t, b, rooms[0])
+	defer unsubscribe()
+	waitSubscribers(t, a, rooms[0], 1)
+	a.Publish(context.Background(), rooms[0], []byte("after"))
+	expectPayload(t, ch, []byte("after"))
+}
+
+// 订阅操作（持有 subMu，可能在等待网络）进行中时，已订阅房间的消息照常投递
+func TestRedisDispatchDuringSubscribe(t *testing.T) {
+	url, _ := testRedis(t)
+	a, b := newTestRedis(t, url), newTestRedis(t, url)
+	room := testRoom(t)
+
+	ch, unsubscribe := subscribeChan(t, b, room)
+	defer unsubscribe()
+	waitSubscribers(t, a, room, 1)
+
+	b.subMu.Lock()
+	a.Publish(context.Background(), room, []byte("during"))
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Error("订阅操作进行中时消息没有被投递")
+	}
+	b.subMu.Unlock()
+}
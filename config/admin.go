@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"os"
+	"time"
+
+	"talkFlow/models"
+	"talkFlow/store"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 首次启动时创建管理员账号，已有管理员时不做任何事：
+//
+//	ADMIN_USERNAME       管理员用户名，默认 admin；只有显式设置时才会把已存在的同名用户提升为管理员
+//	ADMIN_PASSWORD       管理员密码，未设置时随机生成并写入 ADMIN_PASSWORD_FILE
+//	ADMIN_PASSWORD_FILE  保存随机密码的文件，默认 admin_password，权限为 0600
+func InitAdmin() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := Store.Users.CountByRole(ctx, models.RoleAdmin)
+	if err != nil {
+		log.Fatalf("查询管理员失败: %v", err)
+	}
+	if count > 0 {
+		return
+	}
+
+	username := os.Getenv("ADMIN_USERNAME")
+	explicit := username != ""
+	if !explicit {
+		username = "admin"
+	}
+
+	_, err = Store.Users.GetByUsername(ctx, username)
+	if err == nil {
+		// 引入角色之前任何人都可以注册 admin，不能默认把它提升为管理员
+		if !explicit {
+			log.Fatalf("用户 %s 已存在，不会自动设为管理员；请通过 ADMIN_USERNAME 指定一个未注册的用户名，或显式设置为该用户以确认提升", username)
+		}
+		if err := Store.Users.SetRole(ctx, username, models.RoleAdmin); err != nil {
+			log.Fatalf("设置管理员失败: %v", err)
+		}
+		log.Printf("已将用户 %s 设为管理员.", username)
+		return
+	}
+	if err != store.ErrNotFound {
+		log.Fatalf("查询管理员失败: %v", err)
+	}
+
+	password := os.Getenv("ADMIN_PASSWORD")
+	generated := password == ""
+	if generated {
+		buf := make([]byte, 12)
+		if _, err := rand.Read(buf); err != nil {
+			log.Fatalf("生成管理员密码失败: %v", err)
+		}
+		password = hex.EncodeToString(buf)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatalf("管理员密码加密失败: %v", err)
+	}
+
+	// 先写好密码文件再创建账号，避免账号已创建但密码无处可查
+	passwordFile := os.Getenv("ADMIN_PASSWORD_FILE")
+	if passwordFile == "" {
+		passwordFile = "admin_password"
+	}
+	if generated {
+		if err := writePasswordFile(passwordFile, password); err != nil {
+			log.Fatalf("保存管理员初始密码失败: %v", err)
+		}
+	}
+
+	err = Store.Users.Create(ctx, &models.Register{
+		Username:   username,
+		Password:   string(hashed),
+		CreatedAt:  time.Now(),
+		IsRegister: true,
+		Role:       models.RoleAdmin,
+	})
+	if err != nil {
+		log.Fatalf("创建管理员失败: %v", err)
+	}
+
+	if generated {
+		log.Printf("已创建管理员 %s，初始密码已写入 %s（仅当前用户可读），登录后请修改密码并删除该文件", username, passwordFile)
+	} else {
+		log.Printf("已创建管理员 %s.", username)
+	}
+}
+
+// 以 0600 权限新建文件写入密码，已存在的文件先删除，不沿用它的权限
+func writePasswordFile(path, password string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(password + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
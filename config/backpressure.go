@@ -0,0 +1,34 @@
+package config
+
+import (
+	"log"
+	"os"
+)
+
+// 客户端音频发送队列已满时的处理方式，控制消息任何情况下都不会被丢弃
+const (
+	SlowDropOldest = "drop-oldest" // 丢弃队列中最旧的音频帧（默认）
+	SlowDropNewest = "drop-newest" // 丢弃新到的音频帧
+	SlowDisconnect = "disconnect"  // 丢弃新到的音频帧，连续丢弃超过 SlowConsumerMaxDrops 帧后断开
+)
+
+var (
+	SlowConsumerPolicy   string
+	SlowConsumerMaxDrops int
+)
+
+// 读取慢速客户端配置：
+//
+//	SLOW_CONSUMER_POLICY     drop-oldest（默认）、drop-newest 或 disconnect
+//	SLOW_CONSUMER_MAX_DROPS  disconnect 策略下允许连续丢弃的音频帧数，默认 50，0 表示队列满即断开
+func InitBackpressure() {
+	SlowConsumerPolicy = os.Getenv("SLOW_CONSUMER_POLICY")
+	switch SlowConsumerPolicy {
+	case "":
+		SlowConsumerPolicy = SlowDropOldest
+	case SlowDropOldest, SlowDropNewest, SlowDisconnect:
+	default:
+		log.Fatalf("SLOW_CONSUMER_POLICY 只能是 drop-oldest、drop-newest 或 disconnect: %s", SlowConsumerPolicy)
+	}
+	SlowConsumerMaxDrops = parseNonNegative("SLOW_CONSUMER_MAX_DROPS", 50)
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"talkFlow/broker"
+)
+
+// 房间消息在实例之间的转发通道，见 broker 包
+var Broker broker.Broker
+
+// 根据 BROKER 选择实现：memory（默认，单实例部署）或 redis（多实例部署，使用 REDIS_URL）
+func InitBroker() {
+	switch driver := os.Getenv("BROKER"); driver {
+	case "", "memory":
+		Broker = broker.NewMemory()
+	case "redis":
+		url := os.Getenv("REDIS_URL")
+		if url == "" {
+			log.Fatal("BROKER=redis 时必须设置 REDIS_URL")
+		}
+		b, err := broker.NewRedis(url)
+		if err != nil {
+			log.Fatalf("无法连接到 Redis：%v", err)
+		}
+		Broker = b
+		log.Println("成功连接到 Redis，房间消息将在实例之间转发.")
+	default:
+		log.Fatalf("不支持的 BROKER: %s（可选 memory、redis）", driver)
+	}
+}
+
+// 关闭 broker 连接，在所有房间退出后调用
+func CloseBroker() {
+	if err := Broker.Close(); err != nil {
+		log.Printf("关闭 broker 时出错：%v", err)
+	}
+}
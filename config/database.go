@@ -0,0 +1,74 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"talkFlow/store"
+)
+
+// 全局数据访问入口，业务代码通过其中的接口读写数据
+var Store *store.Store
+
+// 根据 DB_DRIVER 连接数据库：sqlite（默认）使用 SQLITE_PATH，postgres 使用 DATABASE_URL
+func InitDatabase() {
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "" {
+		driver = "sqlite"
+	}
+
+	var (
+		s   *store.Store
+		err error
+	)
+	switch driver {
+	case "sqlite":
+		dbPath := os.Getenv("SQLITE_PATH")
+		if dbPath == "" {
+			dbPath = "./db/talkflow.db" // 默认路径
+		}
+		if s, err = store.OpenSQLite(dbPath); err != nil {
+			log.Fatalf("无法连接到SQLite数据库：%v", err)
+		}
+		log.Println("成功连接到 SQLite 数据库.")
+	case "postgres":
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			log.Fatal("DB_DRIVER=postgres 时必须设置 DATABASE_URL")
+		}
+		if s, err = store.OpenPostgres(dsn); err != nil {
+			log.Fatalf("无法连接到PostgreSQL数据库：%v", err)
+		}
+		log.Println("成功连接到 PostgreSQL 数据库.")
+	default:
+		log.Fatalf("不支持的 DB_DRIVER: %s（可选 sqlite、postgres）", driver)
+	}
+
+	Store = s
+}
+
+// 执行所有未执行的数据库迁移（见 migrations 包）
+func RunMigrations() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	count, err := Store.Migrations.Up(ctx)
+	if err != nil {
+		log.Fatalf("数据库迁移失败: %v", err)
+	}
+	if count > 0 {
+		log.Printf("已执行 %d 个数据库迁移.", count)
+	}
+}
+
+// 关闭数据库连接，服务退出前最后调用
+func CloseDatabase() {
+	log.Println("正在关闭数据库连接...")
+	if err := Store.Close(); err != nil {
+		log.Printf("关闭数据库连接时出错：%v", err)
+		return
+	}
+	log.Println("数据库连接已关闭.")
+}
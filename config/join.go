@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+var (
+	JoinMaxFailures    int           // 同一IP或访客ID在统计窗口内最多输错多少次加入码，0 表示不限制
+	JoinFailureWindow  time.Duration // 统计窗口
+	JoinChallengeAfter int           // 输错多少次后加入房间需要先完成工作量证明，0 表示不要求
+	JoinPowDifficulty  int           // 工作量证明要求的前导零比特数
+	JoinAuditRetention time.Duration // 失败记录保留时长
+)
+
+// 读取加入码防枚举配置：
+//
+//	JOIN_MAX_FAILURES       窗口内失败次数上限，默认 20
+//	JOIN_FAILURE_WINDOW     统计窗口秒数，默认 600
+//	JOIN_CHALLENGE_AFTER    失败多少次后要求工作量证明，默认 5
+//	JOIN_POW_DIFFICULTY     工作量证明难度（前导零比特数），默认 18
+//	JOIN_AUDIT_RETENTION    失败记录保留天数，默认 30
+func InitJoinGuard() {
+	JoinMaxFailures = parseNonNegative("JOIN_MAX_FAILURES", 20)
+	JoinFailureWindow = time.Duration(parseNonNegative("JOIN_FAILURE_WINDOW", 600)) * time.Second
+	JoinChallengeAfter = parseNonNegative("JOIN_CHALLENGE_AFTER", 5)
+	JoinPowDifficulty = min(parseNonNegative("JOIN_POW_DIFFICULTY", 18), 32)
+	JoinAuditRetention = time.Duration(parseNonNegative("JOIN_AUDIT_RETENTION", 30)) * 24 * time.Hour
+	// 保留时间至少覆盖统计窗口
+	JoinAuditRetention = max(JoinAuditRetention, JoinFailureWindow)
+}
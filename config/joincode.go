@@ -0,0 +1,41 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// 默认字符集去掉了容易混淆的 0/O 和 1/I
+const defaultJoinCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	JoinCodeLength   int    // 加入码长度
+	JoinCodeAlphabet string // 加入码字符集
+)
+
+// 读取加入码格式：
+//
+//	JOIN_CODE_LENGTH    加入码长度，4 到 32，默认 6
+//	JOIN_CODE_ALPHABET  字符集，至少 10 个不重复的字母或数字，默认 32 个大写字母和数字（不含 0、O、1、I）
+func InitJoinCode() {
+	JoinCodeLength = parseNonNegative("JOIN_CODE_LENGTH", 6)
+	if JoinCodeLength < 4 || JoinCodeLength > 32 {
+		log.Fatalf("JOIN_CODE_LENGTH 只能是 4 到 32: %d", JoinCodeLength)
+	}
+
+	JoinCodeAlphabet = os.Getenv("JOIN_CODE_ALPHABET")
+	if JoinCodeAlphabet == "" {
+		JoinCodeAlphabet = defaultJoinCodeAlphabet
+	}
+	// 加入码会出现在 URL 和路由参数中，只允许不需要转义的字符
+	for i, ch := range JoinCodeAlphabet {
+		if !(ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9') ||
+			strings.ContainsRune(JoinCodeAlphabet[:i], ch) {
+			log.Fatalf("JOIN_CODE_ALPHABET 只能包含不重复的字母和数字: %s", JoinCodeAlphabet)
+		}
+	}
+	if len(JoinCodeAlphabet) < 10 {
+		log.Fatalf("JOIN_CODE_ALPHABET 至少需要 10 个字符: %s", JoinCodeAlphabet)
+	}
+}
@@ -1,5 +1,17 @@
 package config
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 var JWTSecret = []byte(os.Getenv("JWT_SECRET")) // JWT密钥
+
+const (
+	AccessTokenTTL   = 15 * time.Minute    // 访问令牌有效期，尽量短，泄露后影响有限
+	RefreshTokenTTL  = 30 * 24 * time.Hour // 刷新令牌有效期，每次刷新都会轮换
+	RoomTicketTTL    = 2 * time.Minute     // 房间入场凭证有效期，只用于建立 WebSocket 连接
+	EmailVerifyTTL   = 24 * time.Hour      // 邮箱验证链接有效期
+	PasswordResetTTL = 30 * time.Minute    // 重置密码链接有效期
+	MFATokenTTL      = 5 * time.Minute     // 登录时输入两步验证码的时限
+)
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"talkFlow/mailer"
+)
+
+var (
+	Mailer               mailer.Mailer
+	AppBaseURL           string // 邮件中链接的前缀，如 https://talkflow.example.com
+	RequireEmailVerified bool   // 为 true 时未验证邮箱的用户不能创建房间（管理员除外）
+)
+
+// 读取邮件配置：
+//
+//	MAIL_DRIVER             log（默认，只写日志或 MAIL_DIR 目录）或 smtp
+//	MAIL_FROM               发件人，默认 talkFlow <no-reply@localhost>
+//	MAIL_DIR                log 驱动下保存 .eml 文件的目录，为空时打印到日志
+//	SMTP_HOST / SMTP_PORT   SMTP 服务器，端口默认 587，465 使用隐式 TLS
+//	SMTP_USERNAME / SMTP_PASSWORD  为空时不认证
+//	APP_BASE_URL            邮件中链接的前缀，默认 http://localhost:8080
+//	REQUIRE_EMAIL_VERIFIED  true 时未验证邮箱的用户不能创建房间
+func InitMail() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "talkFlow <no-reply@localhost>"
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "log":
+		m, err := mailer.NewLog(from, os.Getenv("MAIL_DIR"))
+		if err != nil {
+			log.Fatalf("无法创建邮件目录: %v", err)
+		}
+		Mailer = m
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			log.Fatal("MAIL_DRIVER=smtp 时必须设置 SMTP_HOST")
+		}
+		port := 587
+		if value := os.Getenv("SMTP_PORT"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 || n > 65535 {
+				log.Fatalf("SMTP_PORT 格式错误: %s", value)
+			}
+			port = n
+		}
+		Mailer = mailer.NewSMTP(mailer.SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		})
+	default:
+		log.Fatalf("不支持的 MAIL_DRIVER: %s（可选 log、smtp）", driver)
+	}
+
+	AppBaseURL = strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if AppBaseURL == "" {
+		AppBaseURL = "http://localhost:8080"
+	}
+	RequireEmailVerified = os.Getenv("REQUIRE_EMAIL_VERIFIED") == "true"
+}
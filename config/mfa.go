@@ -0,0 +1,13 @@
+package config
+
+import "os"
+
+var MFAIssuer string // 身份验证器 App 中显示的服务名称
+
+// 读取 MFA_ISSUER，默认 talkFlow
+func InitMFA() {
+	MFAIssuer = os.Getenv("MFA_ISSUER")
+	if MFAIssuer == "" {
+		MFAIssuer = "talkFlow"
+	}
+}
@@ -0,0 +1,19 @@
+package config
+
+import (
+	"log"
+	"os"
+)
+
+var RecordingDir string // 录音文件保存目录
+
+// 读取录音目录配置（RECORDING_DIR，默认 ./recordings）并确保目录存在
+func InitRecording() {
+	RecordingDir = os.Getenv("RECORDING_DIR")
+	if RecordingDir == "" {
+		RecordingDir = "./recordings"
+	}
+	if err := os.MkdirAll(RecordingDir, 0755); err != nil {
+		log.Fatalf("无法创建录音目录: %v", err)
+	}
+}
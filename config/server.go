@@ -0,0 +1,10 @@
+package config
+
+import "time"
+
+var ShutdownTimeout time.Duration // 收到退出信号后等待请求和 WebSocket 连接结束的最长时间
+
+// 读取 SHUTDOWN_TIMEOUT（秒，默认 10）
+func InitServer() {
+	ShutdownTimeout = time.Duration(parseNonNegative("SHUTDOWN_TIMEOUT", 10)) * time.Second
+}
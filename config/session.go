@@ -0,0 +1,52 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// 同一访客ID重复连接同一房间时的处理方式
+const (
+	SessionReplace = "replace" // 新连接替换旧连接，旧连接被关闭（默认）
+	SessionReject  = "reject"  // 拒绝新连接
+	SessionMulti   = "multi"   // 允许同一访客多设备同时在线
+)
+
+var (
+	SessionPolicy string
+	ResumeGrace   time.Duration // 连接意外断开后保留会话的时间，为 0 时不支持恢复
+	ResumeBuffer  int           // 每个房间保留的最近控制消息条数，用于恢复会话时补发
+)
+
+// 读取会话相关配置：
+//
+//	SESSION_POLICY  replace（默认）、reject 或 multi
+//	RESUME_GRACE    断线后可以恢复会话的秒数，默认 30，0 表示关闭
+//	RESUME_BUFFER   每个房间保留的控制消息条数，默认 200
+func InitSession() {
+	SessionPolicy = os.Getenv("SESSION_POLICY")
+	switch SessionPolicy {
+	case "":
+		SessionPolicy = SessionReplace
+	case SessionReplace, SessionReject, SessionMulti:
+	default:
+		log.Fatalf("SESSION_POLICY 只能是 replace、reject 或 multi: %s", SessionPolicy)
+	}
+
+	ResumeGrace = time.Duration(parseNonNegative("RESUME_GRACE", 30)) * time.Second
+	ResumeBuffer = parseNonNegative("RESUME_BUFFER", 200)
+}
+
+func parseNonNegative(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("%s 格式错误: %s", key, value)
+	}
+	return n
+}
@@ -0,0 +1,38 @@
+package config
+
+import "time"
+
+var (
+	LoginMaxFailures   int           // 同一用户名连续失败多少次后锁定，0 表示不限制
+	LoginIPMaxFailures int           // 同一IP连续失败多少次后锁定，0 表示不限制
+	LoginLockout       time.Duration // 首次锁定的时长，之后每次失败翻倍
+	LoginLockoutMax    time.Duration // 锁定时长上限
+	LoginFailureWindow time.Duration // 超过该时间没有失败（且不在锁定中）则重新计数
+
+	PasswordResetMaxRequests   int // 同一邮箱申请多少次重置密码后锁定，0 表示不限制
+	PasswordResetIPMaxRequests int // 同一IP申请多少次重置密码后锁定，0 表示不限制
+)
+
+// 读取登录限流配置：
+//
+//	LOGIN_MAX_FAILURES     同一用户名的失败次数上限，默认 5
+//	LOGIN_IP_MAX_FAILURES  同一IP的失败次数上限，默认 20
+//	LOGIN_LOCKOUT          首次锁定秒数，默认 60
+//	LOGIN_LOCKOUT_MAX      最长锁定秒数，默认 3600
+//	LOGIN_FAILURE_WINDOW   失败计数的有效秒数，默认 900
+//	PASSWORD_RESET_MAX_REQUESTS     同一邮箱的重置密码申请次数上限，默认 3
+//	PASSWORD_RESET_IP_MAX_REQUESTS  同一IP的重置密码申请次数上限，默认 10
+//
+// 重置密码申请与登录失败使用相同的锁定时长和计数窗口。
+func InitThrottle() {
+	LoginMaxFailures = parseNonNegative("LOGIN_MAX_FAILURES", 5)
+	LoginIPMaxFailures = parseNonNegative("LOGIN_IP_MAX_FAILURES", 20)
+	LoginLockout = time.Duration(parseNonNegative("LOGIN_LOCKOUT", 60)) * time.Second
+	LoginLockoutMax = time.Duration(parseNonNegative("LOGIN_LOCKOUT_MAX", 3600)) * time.Second
+	LoginFailureWindow = time.Duration(parseNonNegative("LOGIN_FAILURE_WINDOW", 900)) * time.Second
+	PasswordResetMaxRequests = parseNonNegative("PASSWORD_RESET_MAX_REQUESTS", 3)
+	PasswordResetIPMaxRequests = parseNonNegative("PASSWORD_RESET_IP_MAX_REQUESTS", 10)
+	if LoginLockoutMax < LoginLockout {
+		LoginLockoutMax = LoginLockout
+	}
+}
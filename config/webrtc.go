@@ -0,0 +1,72 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ICE 服务器配置，字段名与浏览器 RTCIceServer 保持一致，可直接传给 RTCPeerConnection
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+var ICEServers []ICEServer
+
+// 内置 SFU 的网络配置
+var (
+	SFUPublicIPs []string // SFU_PUBLIC_IP：服务器在 NAT/Docker 之后时对外公布的 IP，逗号分隔
+	SFUPortMin   uint16   // SFU_UDP_PORT_MIN / SFU_UDP_PORT_MAX：SFU 使用的 UDP 端口范围
+	SFUPortMax   uint16
+)
+
+// 从环境变量读取 STUN/TURN 服务器和 SFU 配置：
+//
+//	ICE_SERVERS      逗号分隔的 STUN 地址，未设置时使用 Google 公共 STUN
+//	TURN_SERVER      逗号分隔的 TURN 地址
+//	TURN_USERNAME    TURN 用户名
+//	TURN_CREDENTIAL  TURN 密码
+func InitWebRTC() {
+	stun := os.Getenv("ICE_SERVERS")
+	if stun == "" {
+		stun = "stun:stun.l.google.com:19302"
+	}
+	ICEServers = []ICEServer{{URLs: splitList(stun)}}
+
+	if turn := os.Getenv("TURN_SERVER"); turn != "" {
+		ICEServers = append(ICEServers, ICEServer{
+			URLs:       splitList(turn),
+			Username:   os.Getenv("TURN_USERNAME"),
+			Credential: os.Getenv("TURN_CREDENTIAL"),
+		})
+	}
+
+	SFUPublicIPs = splitList(os.Getenv("SFU_PUBLIC_IP"))
+	SFUPortMin = parsePort("SFU_UDP_PORT_MIN")
+	SFUPortMax = parsePort("SFU_UDP_PORT_MAX")
+}
+
+func parsePort(key string) uint16 {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		log.Fatalf("%s 格式错误: %v", key, err)
+	}
+	return uint16(port)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
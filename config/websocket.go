@@ -0,0 +1,10 @@
+package config
+
+import "os"
+
+var WSCompression bool // 是否协商 permessage-deflate，只对控制消息压缩
+
+// 读取 WS_COMPRESSION（true 开启，默认关闭）
+func InitWebSocket() {
+	WSCompression = os.Getenv("WS_COMPRESSION") == "true"
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListUsers 列出所有用户及其角色（仅管理员）
+func ListUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	users, err := config.Store.Users.List(ctx)
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), fmt.Sprintf("List users error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败", "eventID": logID})
+		return
+	}
+
+	list := make([]gin.H, 0, len(users))
+	for _, u := range users {
+		list = append(list, gin.H{
+			"id":             u.ID,
+			"username":       u.Username,
+			"email":          u.Email,
+			"role":           u.Role,
+			"created_at":     u.CreatedAt,
+			"email_verified": u.EmailVerified,
+			"mfa_enabled":    u.MFAEnabled,
+		})
+	}
+	c.JSON(200, gin.H{"code": 20000, "users": list})
+}
+
+// GrantRole 设置用户角色（仅管理员）
+func GrantRole(c *gin.Context) {
+	var input struct {
+		Role models.Role `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || !input.Role.Valid() {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+	setRole(c, c.Param("username"), input.Role)
+}
+
+// RevokeRole 收回用户的角色，恢复为普通成员（仅管理员）
+func RevokeRole(c *gin.Context) {
+	setRole(c, c.Param("username"), models.RoleMember)
+}
+
+func setRole(c *gin.Context, username string, role models.Role) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := config.Store.Users.GetByUsername(ctx, username)
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40404, "error": "用户不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(c.GetString("username"), fmt.Sprintf("Set role lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	// 至少保留一个管理员，避免无人能够管理角色
+	if user.Role == models.RoleAdmin && role != models.RoleAdmin {
+		count, err := config.Store.Users.CountByRole(ctx, models.RoleAdmin)
+		if err != nil {
+			c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+			utils.Logger(c.GetString("username"), fmt.Sprintf("Count admins error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+			return
+		}
+		if count <= 1 {
+			c.JSON(409, gin.H{"code": 40904, "error": "不能移除最后一个管理员"})
+			return
+		}
+	}
+
+	if err := config.Store.Users.SetRole(ctx, username, role); err != nil {
+		c.JSON(500, gin.H{"code": 50005, "error": "设置角色失败"})
+		utils.Logger(c.GetString("username"), fmt.Sprintf("Set role error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "角色已更新", "username": username, "role": role})
+}
+
+// ListLockouts 列出登录失败记录，locked 表示当前仍在锁定中（仅管理员）
+func ListLockouts(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, err := config.Store.Throttles.List(ctx)
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), fmt.Sprintf("List lockouts error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败", "eventID": logID})
+		return
+	}
+
+	now := time.Now()
+	list := make([]gin.H, 0, len(entries))
+	for _, e := range entries {
+		retryAfter := 0
+		if e.LockedUntil != nil && e.LockedUntil.After(now) {
+			retryAfter = int(math.Ceil(e.LockedUntil.Sub(now).Seconds()))
+		}
+		list = append(list, gin.H{
+			"scope":        e.Scope,
+			"key":          e.Key,
+			"failures":     e.Failures,
+			"last_failure": e.LastFailure,
+			"locked_until": e.LockedUntil,
+			"locked":       retryAfter > 0,
+			"retry_after":  retryAfter,
+		})
+	}
+	c.JSON(200, gin.H{"code": 20000, "lockouts": list})
+}
+
+// ClearLockout 清除用户名或IP的登录失败记录并解除锁定（仅管理员）
+func ClearLockout(c *gin.Context) {
+	scope := c.Param("scope")
+	switch scope {
+	case models.ThrottleUser, models.ThrottleIP, models.ThrottleResetEmail, models.ThrottleResetIP:
+	default:
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := config.Store.Throttles.Delete(ctx, scope, c.Param("key"))
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40407, "error": "登录失败记录不存在"})
+		return
+	}
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), fmt.Sprintf("Clear lockout error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50005, "error": "解除锁定失败", "eventID": logID})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "已解除锁定"})
+}
+
+// ListJoinFailures 列出最近的加入码校验失败记录，limit 默认 100，最多 1000（仅管理员）
+func ListJoinFailures(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	failures, err := config.Store.JoinFailures.List(ctx, limit)
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), fmt.Sprintf("List join failures error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败", "eventID": logID})
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "failures": failures})
+}
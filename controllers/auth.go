@@ -6,11 +6,14 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
 	"talkFlow/config"
 	"talkFlow/models"
+	"talkFlow/store"
 	"talkFlow/utils"
 
 	"github.com/gin-gonic/gin"
@@ -34,24 +37,18 @@ func Register(c *gin.Context) {
 	defer cancel()
 
 	// 检查用户名是否存在
-	var existingUserID int
-	checkUserSQL := "SELECT id FROM register WHERE username = ?"
-	err := config.DB.QueryRowContext(ctx, checkUserSQL, input.Username).Scan(&existingUserID)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// 当用户名不存在的时候则创建新用户
-		} else {
-			// An error occurred during the query
-			c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
-			log.Printf("Error checking if username exists: %v", err)
-			return
-		}
-	} else {
+	_, err := config.Store.Users.GetByUsername(ctx, input.Username)
+	if err == nil {
 		// 用户已存在就返回错误
 		c.JSON(400, gin.H{"code": 40003, "error": "用户名已存在"})
 		return
 	}
+	if err != store.ErrNotFound {
+		// An error occurred during the query
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		log.Printf("Error checking if username exists: %v", err)
+		return
+	}
 
 	// 生成头像
 	email := strings.TrimSpace(strings.ToLower(input.Email))
@@ -77,15 +74,12 @@ func Register(c *gin.Context) {
 		IsRegister: true,
 	}
 
-	// Insert the new user into the database
-	insertSQL := `
-		INSERT INTO register (username, password, email, avatar, created_at, register_ip, is_register)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err = config.DB.ExecContext(ctx, insertSQL,
-		user.Username, user.Password, user.Email, user.Avatar,
-		user.CreatedAt, user.RegisterIP, user.IsRegister,
-	)
-
+	// Insert the new user into the database，并发注册同名用户时由唯一约束兜底
+	err = config.Store.Users.Create(ctx, &user)
+	if err == store.ErrDuplicate {
+		c.JSON(400, gin.H{"code": 40003, "error": "用户名已存在"})
+		return
+	}
 	if err != nil {
 		c.JSON(500, gin.H{"code": 50001, "error": "注册失败"})
 		utils.Logger(user.Username, fmt.Sprintf("Register DB insert error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
@@ -93,7 +87,18 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{"code": 20000, "message": "注册成功"})
+	// 发送失败不影响注册，用户登录后可以重新发送
+	emailSent := false
+	if user.Email != "" {
+		if err := sendVerificationEmail(ctx, &user); err != nil {
+			utils.Logger(user.Username, fmt.Sprintf("Send verification email error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+			log.Printf("发送验证邮件失败: %v", err)
+		} else {
+			emailSent = true
+		}
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "注册成功", "email_sent": emailSent})
 }
 
 // Login handles user login
@@ -111,25 +116,23 @@ func Login(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.Register
-	query := "SELECT id, username, password, email, avatar, created_at, register_ip, is_register, last_login_ip, last_login_time FROM register WHERE username = ?"
-	row := config.DB.QueryRowContext(ctx, query, input.Username)
-	err := row.Scan(
-		&user.ID,
-		&user.Username,
-		&user.Password,
-		&user.Email,
-		&user.Avatar,
-		&user.CreatedAt,
-		&user.RegisterIP,
-		&user.IsRegister,
-		&user.LastLoginIP,
-		&user.LastLoginTime,
-	)
+	// 用户名或IP被锁定时直接拒绝，不比对密码
+	wait, err := utils.LoginRetryAfter(ctx, input.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(input.Username, fmt.Sprintf("Login throttle lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
 
+	user, err := config.Store.Users.GetByUsername(ctx, input.Username)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(400, gin.H{"code": 40002, "error": "用户名或密码错误"})
+		if err == store.ErrNotFound {
+			// 不存在的用户名同样计入失败次数，避免通过是否锁定判断用户名是否存在
+			loginFailed(ctx, c, input.Username, 40002, "用户名或密码错误")
 		} else {
 			c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
 			utils.Logger(input.Username, fmt.Sprintf("Login DB scan error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
@@ -139,12 +142,39 @@ func Login(c *gin.Context) {
 
 	// 比对密码
 	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
-		c.JSON(400, gin.H{"code": 40002, "error": "用户名或密码错误"})
+		loginFailed(ctx, c, input.Username, 40002, "用户名或密码错误")
 		return
 	}
 
-	// 生成 Auth Token
-	token, errToken := utils.GenerateToken(user.Username)
+	// 开启了两步验证时先签发两步验证令牌，提交验证码后再签发访问令牌
+	if user.MFAEnabled {
+		mfaToken, exp, err := utils.GenerateMFAToken(user.Username)
+		if err != nil {
+			c.JSON(500, gin.H{"code": 50002, "error": "生成token失败"})
+			utils.Logger(user.Username, err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+			return
+		}
+		c.JSON(200, gin.H{
+			"code":         20001,
+			"message":      "请输入两步验证码",
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int(time.Until(exp).Seconds()),
+		})
+		return
+	}
+
+	completeLogin(ctx, c, user)
+}
+
+// 登录成功：清除失败记录，签发令牌并更新登录信息
+func completeLogin(ctx context.Context, c *gin.Context, user *models.Register) {
+	if err := utils.ClearLoginFailures(ctx, user.Username); err != nil {
+		log.Printf("清除登录失败记录失败: %v", err)
+	}
+
+	// 生成访问令牌和刷新令牌
+	tokens, errToken := issueTokens(ctx, user.Username, "", c.ClientIP())
 	if errToken != nil {
 		c.JSON(500, gin.H{"code": 50002, "error": "生成token失败"})
 		utils.Logger(user.Username, errToken.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
@@ -154,8 +184,7 @@ func Login(c *gin.Context) {
 	// 更新每一次登录的 IP 和时间
 	loginIP := c.ClientIP()
 	loginTime := time.Now()
-	updateQuery := "UPDATE register SET last_login_ip = ?, last_login_time = ? WHERE id = ?"
-	_, errDbUpdate := config.DB.ExecContext(ctx, updateQuery, loginIP, loginTime, user.ID)
+	errDbUpdate := config.Store.Users.UpdateLastLogin(ctx, user.ID, loginIP, loginTime)
 	if errDbUpdate != nil {
 		c.JSON(500, gin.H{"code": 50003, "error": "更新登录信息失败"})
 		utils.Logger(user.Username, errDbUpdate.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
@@ -163,7 +192,139 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{"code": 20000, "message": "登录成功", "token": token})
+	tokens["code"] = 20000
+	tokens["message"] = "登录成功"
+	c.JSON(200, tokens)
+}
+
+// 记录登录失败，达到上限时返回 429，否则返回 code 和 message
+func loginFailed(ctx context.Context, c *gin.Context, username string, code int, message string) {
+	locked, err := utils.RecordLoginFailure(ctx, username, c.ClientIP())
+	if err != nil {
+		log.Printf("记录登录失败次数失败: %v", err)
+	}
+	if locked > 0 {
+		utils.Logger(username, fmt.Sprintf("Login locked for %s after repeated failures", locked), time.Now().Format(time.RFC3339), c.ClientIP())
+		tooManyLoginAttempts(c, locked)
+		return
+	}
+	c.JSON(400, gin.H{"code": code, "error": message})
+}
+
+func tooManyLoginAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(429, gin.H{"code": 42901, "error": "登录失败次数过多，请稍后再试", "retry_after": seconds})
+}
+
+// 签发一对访问令牌和刷新令牌，family 为空时开启新的会话
+func issueTokens(ctx context.Context, username, family, ip string) (gin.H, error) {
+	accessToken, _, _, err := utils.GenerateToken(username)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := utils.IssueRefreshToken(ctx, username, family, ip)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// Refresh 使用刷新令牌换取新的令牌对，旧的刷新令牌随即失效
+func Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username, refreshToken, err := utils.RotateRefreshToken(ctx, input.RefreshToken, c.ClientIP())
+	if err != nil {
+		switch err {
+		case utils.ErrRefreshTokenInvalid, utils.ErrRefreshTokenExpired:
+			c.JSON(401, gin.H{"code": 40005, "error": "刷新令牌无效或已过期"})
+		case utils.ErrRefreshTokenReused:
+			c.JSON(401, gin.H{"code": 40006, "error": "刷新令牌已被使用，请重新登录"})
+			log.Printf("检测到刷新令牌重复使用: %s", c.ClientIP())
+		default:
+			c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+			utils.Logger("unknown", fmt.Sprintf("Refresh token rotate error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		}
+		return
+	}
+
+	accessToken, _, _, err := utils.GenerateToken(username)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50002, "error": "生成token失败"})
+		utils.Logger(username, err.Error(), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":          20000,
+		"message":       "刷新成功",
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.AccessTokenTTL.Seconds()),
+	})
+}
+
+// Logout 吊销当前访问令牌；传入 refresh_token 时同时吊销该会话，all 为 true 时退出所有设备
+func Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	// 请求体可选
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+			return
+		}
+	}
+
+	username := c.GetString("username")
+	jti := c.GetString("jti")
+	exp := c.GetTime("token_exp")
+	if exp.IsZero() {
+		exp = time.Now().Add(config.AccessTokenTTL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := utils.RevokeJTI(ctx, jti, username, exp); err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "退出登录失败"})
+		utils.Logger(username, fmt.Sprintf("Logout revoke jti error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	if input.All {
+		if err := utils.RevokeUserRefreshTokens(ctx, username); err != nil {
+			c.JSON(500, gin.H{"code": 50003, "error": "退出登录失败"})
+			utils.Logger(username, fmt.Sprintf("Logout revoke all error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+			return
+		}
+	} else if input.RefreshToken != "" {
+		// 无效的刷新令牌直接忽略，访问令牌已经吊销
+		err := utils.RevokeRefreshToken(ctx, input.RefreshToken, username)
+		if err != nil && err != utils.ErrRefreshTokenInvalid {
+			c.JSON(500, gin.H{"code": 50003, "error": "退出登录失败"})
+			utils.Logger(username, fmt.Sprintf("Logout revoke refresh error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "已退出登录"})
 }
 
 // NullTime is a helper type for scanning nullable time.Time values from the database
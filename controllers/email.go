@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/mailer"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errNoEmail = errors.New("user has no email")
+
+// 签发验证令牌并发送验证邮件
+func sendVerificationEmail(ctx context.Context, user *models.Register) error {
+	if user.Email == "" {
+		return errNoEmail
+	}
+	token, err := utils.IssueEmailToken(ctx, user.Username, user.Email, models.EmailTokenVerify)
+	if err != nil {
+		return err
+	}
+	link := config.AppBaseURL + "/api/v1/auth/verify?token=" + url.QueryEscape(token)
+	return config.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "验证你的 talkFlow 邮箱",
+		Body: fmt.Sprintf("%s，你好：\n\n请在 %d 小时内打开下面的链接完成邮箱验证：\n\n%s\n\n如果这不是你的操作，请忽略这封邮件。\n",
+			user.Username, int(config.EmailVerifyTTL.Hours()), link),
+	})
+}
+
+// 签发重置令牌并发送重置密码邮件
+func sendPasswordResetEmail(ctx context.Context, user *models.Register) error {
+	token, err := utils.IssueEmailToken(ctx, user.Username, user.Email, models.EmailTokenReset)
+	if err != nil {
+		return err
+	}
+	link := config.AppBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return config.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "重置你的 talkFlow 密码",
+		Body: fmt.Sprintf("%s，你好：\n\n我们收到了重置密码的请求，请在 %d 分钟内打开下面的链接设置新密码：\n\n%s\n\n重置令牌：%s\n\n如果这不是你的操作，请忽略这封邮件，你的密码不会被修改。\n",
+			user.Username, int(config.PasswordResetTTL.Minutes()), link, token),
+	})
+}
+
+// VerifyEmailPage 显示邮件链接打开的确认页面，用户点击按钮后才提交令牌。
+// GET 请求不消耗令牌，邮件客户端或安全网关预先访问链接不会让它失效。
+func VerifyEmailPage(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	renderVerifyPage(c, 200, verifyPage{Token: c.Query("token")})
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱。令牌可以放在请求体（JSON 或确认页面提交的表单）或 query 中，
+// 从确认页面提交时返回页面，否则返回 JSON。
+func VerifyEmail(c *gin.Context) {
+	fromPage := c.ContentType() == binding.MIMEPOSTForm
+	reply := func(status int, body gin.H) {
+		if !fromPage {
+			c.JSON(status, body)
+			return
+		}
+		page := verifyPage{Done: true, OK: status == 200}
+		page.Message, _ = body["message"].(string)
+		if !page.OK {
+			page.Message, _ = body["error"].(string)
+		}
+		renderVerifyPage(c, status, page)
+	}
+
+	token := c.Query("token")
+	if fromPage {
+		token = c.PostForm("token")
+	} else if token == "" {
+		var input struct {
+			Token string `json:"token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+			return
+		}
+		token = input.Token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	et, err := utils.ConsumeEmailToken(ctx, token, models.EmailTokenVerify)
+	if err == utils.ErrEmailTokenInvalid || err == utils.ErrEmailTokenExpired {
+		reply(400, gin.H{"code": 40007, "error": "验证链接无效或已过期"})
+		return
+	}
+	if err != nil {
+		reply(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger("unknown", fmt.Sprintf("Verify email token error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	user, err := config.Store.Users.GetByUsername(ctx, et.Username)
+	if err == store.ErrNotFound || (err == nil && user.Email != et.Email) {
+		// 签发之后邮箱已被修改
+		reply(400, gin.H{"code": 40007, "error": "验证链接无效或已过期"})
+		return
+	}
+	if err == nil {
+		err = config.Store.Users.SetEmailVerified(ctx, user.Username, true)
+	}
+	if err != nil {
+		reply(500, gin.H{"code": 50003, "error": "更新用户信息失败"})
+		utils.Logger(et.Username, fmt.Sprintf("Verify email update error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	reply(200, gin.H{"code": 20000, "message": "邮箱验证成功"})
+}
+
+// ResendVerification 重新发送验证邮件，之前的验证链接随即失效
+func ResendVerification(c *gin.Context) {
+	username := c.GetString("username")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := config.Store.Users.GetByUsername(ctx, username)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(username, fmt.Sprintf("Resend verification query error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(400, gin.H{"code": 40008, "error": "邮箱已验证"})
+		return
+	}
+	if user.Email == "" {
+		c.JSON(400, gin.H{"code": 40009, "error": "未设置邮箱"})
+		return
+	}
+
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		c.JSON(500, gin.H{"code": 50005, "error": "发送邮件失败"})
+		utils.Logger(username, fmt.Sprintf("Send verification email error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "验证邮件已发送"})
+}
+
+// 后台发送中的重置密码邮件，关闭服务时等待发送完成再关闭数据库
+var mailSends sync.WaitGroup
+
+// WaitMail 等待后台发送的邮件全部完成，ctx 结束时返回错误
+func WaitMail(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		mailSends.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ForgotPassword 向该邮箱下已验证邮箱的账号发送重置密码邮件。
+// 无论邮箱是否注册都返回相同的结果，邮件在后台发送，避免通过响应内容或耗时判断邮箱是否存在。
+// 邮箱和IP分别限流，防止被用来向他人邮箱大量发信。
+func ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ip := c.ClientIP()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	wait, err := utils.PasswordResetRetryAfter(ctx, input.Email, ip)
+	if err == nil && wait <= 0 {
+		_, err = utils.RecordPasswordResetRequest(ctx, input.Email, ip)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger("unknown", fmt.Sprintf("Forgot password throttle error: %v", err), time.Now().Format(time.RFC3339), ip)
+		return
+	}
+	if wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(429, gin.H{"code": 42904, "error": "重置密码请求过于频繁，请稍后再试", "retry_after": seconds})
+		return
+	}
+
+	mailSends.Add(1)
+	go func() {
+		defer mailSends.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		users, err := config.Store.Users.ListByEmail(ctx, input.Email)
+		if err != nil {
+			utils.Logger("unknown", fmt.Sprintf("Forgot password query error: %v", err), time.Now().Format(time.RFC3339), ip)
+			return
+		}
+		for i := range users {
+			// 未验证的邮箱不一定属于该用户，不能用来接管账号
+			if !users[i].EmailVerified {
+				continue
+			}
+			if err := sendPasswordResetEmail(ctx, &users[i]); err != nil {
+				utils.Logger(users[i].Username, fmt.Sprintf("Send password reset email error: %v", err), time.Now().Format(time.RFC3339), ip)
+				log.Printf("发送重置密码邮件失败: %v", err)
+			}
+		}
+	}()
+
+	c.JSON(200, gin.H{"code": 20000, "message": "如果该邮箱已注册并通过验证，重置密码邮件已发送"})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，成功后该用户所有设备都需要重新登录
+func ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	et, err := utils.ConsumeEmailToken(ctx, input.Token, models.EmailTokenReset)
+	if err == utils.ErrEmailTokenInvalid || err == utils.ErrEmailTokenExpired {
+		c.JSON(400, gin.H{"code": 40007, "error": "重置链接无效或已过期"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger("unknown", fmt.Sprintf("Reset password token error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50004, "error": "密码加密失败"})
+		log.Printf("Error hashing password: %v", err)
+		return
+	}
+	err = config.Store.Users.UpdatePassword(ctx, et.Username, string(hashedPassword), time.Now())
+	if err == store.ErrNotFound {
+		c.JSON(400, gin.H{"code": 40007, "error": "重置链接无效或已过期"})
+		return
+	}
+	if err == nil {
+		err = utils.RevokeUserRefreshTokens(ctx, et.Username)
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "重置密码失败"})
+		utils.Logger(et.Username, fmt.Sprintf("Reset password update error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "密码已重置，请重新登录"})
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/mailer"
+	"talkFlow/middleware"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// 记录发出的邮件
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *fakeMailer) recipients() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var to []string
+	for _, msg := range m.sent {
+		to = append(to, msg.To)
+	}
+	return to
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	config.JWTSecret = []byte("test-secret")
+	config.LoginFailureWindow = 15 * time.Minute
+	config.LoginLockout = time.Minute
+	config.LoginLockoutMax = time.Hour
+	os.Exit(m.Run())
+}
+
+// 每个测试使用新的内存存储和邮件记录
+func newTestEnv(t *testing.T) (*gin.Engine, *fakeMailer) {
+	oldStore, oldMailer := config.Store, config.Mailer
+	oldMax, oldIPMax := config.PasswordResetMaxRequests, config.PasswordResetIPMaxRequests
+	t.Cleanup(func() {
+		waitMail(t) // 后台发送还在使用存储
+		config.Store, config.Mailer = oldStore, oldMailer
+		config.PasswordResetMaxRequests, config.PasswordResetIPMaxRequests = oldMax, oldIPMax
+	})
+	config.Store = store.NewMemory()
+	m := &fakeMailer{}
+	config.Mailer = m
+	config.PasswordResetMaxRequests, config.PasswordResetIPMaxRequests = 3, 10
+
+	r := gin.New()
+	r.GET("/api/v1/auth/verify", VerifyEmailPage)
+	r.POST("/api/v1/auth/verify", VerifyEmail)
+	r.POST("/api/v1/auth/forgot-password", ForgotPassword)
+	return r, m
+}
+
+func createUser(t *testing.T, username, email string, verified bool) {
+	t.Helper()
+	err := config.Store.Users.Create(context.Background(), &models.Register{
+		Username:      username,
+		Email:         email,
+		EmailVerified: verified,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func forgotPassword(r *gin.Engine, email, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v1/auth/forgot-password", strings.NewReader(`{"email":"`+email+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func waitMail(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := WaitMail(ctx); err != nil {
+		t.Fatalf("等待邮件发送: %v", err)
+	}
+}
+
+func TestForgotPasswordOnlyMailsVerifiedEmail(t *testing.T) {
+	r, m := newTestEnv(t)
+	createUser(t, "alice", "shared@example.com", true)
+	createUser(t, "mallory", "shared@example.com", false)
+
+	if w := forgotPassword(r, "shared@example.com", "10.0.0.1"); w.Code != 200 {
+		t.Fatalf("状态码 %d: %s", w.Code, w.Body)
+	}
+	waitMail(t)
+
+	got := m.recipients()
+	if len(got) != 1 {
+		t.Fatalf("发出 %d 封邮件，期望只发给已验证的账号", len(got))
+	}
+	if !strings.Contains(m.sent[0].Body, "alice") {
+		t.Fatalf("重置邮件发给了错误的账号: %q", m.sent[0].Body)
+	}
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	r, m := newTestEnv(t)
+	createUser(t, "alice", "alice@example.com", true)
+
+	// 同一邮箱：不同 IP 也只能申请 3 次，大小写不同视为同一邮箱
+	for i, email := range []string{"alice@example.com", "Alice@example.com", "alice@example.com"} {
+		if w := forgotPassword(r, email, "10.0.1."+string(rune('1'+i))); w.Code != 200 {
+			t.Fatalf("第 %d 次申请状态码 %d: %s", i+1, w.Code, w.Body)
+		}
+	}
+	w := forgotPassword(r, "alice@example.com", "10.0.1.9")
+	if w.Code != 429 || w.Header().Get("Retry-After") == "" || !strings.Contains(w.Body.String(), "42904") {
+		t.Fatalf("超过邮箱上限后状态码 %d、Retry-After %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+	waitMail(t)
+	if n := len(m.recipients()); n != 3 {
+		t.Fatalf("发出 %d 封邮件，期望 3", n)
+	}
+
+	// 同一 IP：换邮箱（包括未注册的）也受限
+	for i := 0; i < 10; i++ {
+		if w := forgotPassword(r, "nobody"+string(rune('a'+i))+"@example.com", "10.0.2.1"); w.Code != 200 {
+			t.Fatalf("第 %d 次申请状态码 %d", i+1, w.Code)
+		}
+	}
+	if w := forgotPassword(r, "other@example.com", "10.0.2.1"); w.Code != 429 {
+		t.Fatalf("超过 IP 上限后状态码 %d，期望 429", w.Code)
+	}
+}
+
+func TestVerifyEmailGetDoesNotConsumeToken(t *testing.T) {
+	r, _ := newTestEnv(t)
+	createUser(t, "alice", "alice@example.com", false)
+	token, err := utils.IssueEmailToken(context.Background(), "alice", "alice@example.com", models.EmailTokenVerify)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 邮件扫描器可能多次打开链接
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/verify?token="+url.QueryEscape(token), nil))
+		if w.Code != 200 || !strings.Contains(w.Body.String(), `method="post"`) {
+			t.Fatalf("确认页面状态码 %d: %s", w.Code, w.Body)
+		}
+	}
+	if user, _ := config.Store.Users.GetByUsername(context.Background(), "alice"); user.EmailVerified {
+		t.Fatal("GET 请求不应完成验证")
+	}
+
+	// 确认页面提交的表单
+	submit := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/auth/verify", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := submit(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "邮箱验证成功") {
+		t.Fatalf("提交状态码 %d: %s", w.Code, w.Body)
+	}
+	if user, _ := config.Store.Users.GetByUsername(context.Background(), "alice"); !user.EmailVerified {
+		t.Fatal("提交后邮箱应已验证")
+	}
+	if w := submit(); w.Code != 400 {
+		t.Fatalf("令牌只能使用一次，再次提交状态码 %d", w.Code)
+	}
+}
+
+// 按指定的签发时间生成访问令牌
+func accessTokenIssuedAt(t *testing.T, username string, iat time.Time) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": username,
+		"typ":      utils.TokenTypeAccess,
+		"jti":      fmt.Sprintf("jti-%d", iat.UnixNano()),
+		"iat":      iat.Unix(),
+		"exp":      iat.Add(config.AccessTokenTTL).Unix(),
+	}).SignedString(config.JWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// 重置密码后，之前签发的访问令牌立即失效
+func TestResetPasswordRevokesAccessTokens(t *testing.T) {
+	r, _ := newTestEnv(t)
+	r.POST("/api/v1/auth/reset-password", ResetPassword)
+	r.GET("/api/v1/profile", middleware.JWTAuth(), func(c *gin.Context) { c.JSON(200, gin.H{"code": 20000}) })
+	createUser(t, "alice", "alice@example.com", true)
+
+	profile := func(token string) int {
+		req := httptest.NewRequest("GET", "/api/v1/profile", nil)
+		req.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	before := accessTokenIssuedAt(t, "alice", time.Now().Add(-time.Minute))
+	if code := profile(before); code != 200 {
+		t.Fatalf("重置前状态码 %d", code)
+	}
+
+	reset, err := utils.IssueEmailToken(context.Background(), "alice", "alice@example.com", models.EmailTokenReset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/auth/reset-password", strings.NewReader(`{"token":"`+reset+`","password":"new-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("重置密码状态码 %d: %s", w.Code, w.Body)
+	}
+
+	if code := profile(before); code != 401 {
+		t.Fatalf("重置前签发的令牌状态码 %d，期望 401", code)
+	}
+	if code := profile(accessTokenIssuedAt(t, "alice", time.Now().Add(2*time.Second))); code != 200 {
+		t.Fatalf("重置后签发的令牌状态码 %d，期望 200", code)
+	}
+}
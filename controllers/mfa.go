@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"talkFlow/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 校验 TOTP 验证码或恢复码，recoveryCode 不为空时优先使用恢复码
+func checkSecondFactor(ctx context.Context, user *models.Register, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return utils.UseRecoveryCode(ctx, user.Username, recoveryCode)
+	}
+	return utils.ValidateTOTP(ctx, user, code)
+}
+
+// VerifyMFA 登录第二步：提交两步验证令牌和验证码（或恢复码），通过后签发访问令牌
+func VerifyMFA(c *gin.Context) {
+	var input struct {
+		MFAToken     string `json:"mfa_token" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+
+	claims, err := utils.ParseMFAToken(input.MFAToken)
+	if err != nil {
+		c.JSON(401, gin.H{"code": 40010, "error": "两步验证已过期，请重新登录"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 验证码同样受登录限流保护
+	wait, err := utils.LoginRetryAfter(ctx, claims.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(claims.Username, fmt.Sprintf("MFA throttle lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+
+	used, err := utils.IsJTIRevoked(ctx, claims.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(claims.Username, fmt.Sprintf("MFA token lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	user, err := config.Store.Users.GetByUsername(ctx, claims.Username)
+	if err != nil && err != store.ErrNotFound {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(claims.Username, fmt.Sprintf("MFA user lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	// 令牌已使用、用户已删除或两步验证已被重置时需要重新登录
+	if used || err == store.ErrNotFound || !user.MFAEnabled {
+		c.JSON(401, gin.H{"code": 40010, "error": "两步验证已过期，请重新登录"})
+		return
+	}
+
+	ok, err := checkSecondFactor(ctx, user, input.Code, input.RecoveryCode)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(user.Username, fmt.Sprintf("MFA verify error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if !ok {
+		loginFailed(ctx, c, user.Username, 40011, "验证码错误")
+		return
+	}
+
+	// 上面的检查和验证码校验之间可能有并发的请求用同一个令牌通过，以使用令牌是否成功为准
+	consumed, err := utils.ConsumeJTI(ctx, claims.ID, user.Username, claims.ExpiresAt.Time)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "更新登录信息失败"})
+		utils.Logger(user.Username, fmt.Sprintf("MFA token revoke error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if !consumed {
+		c.JSON(401, gin.H{"code": 40010, "error": "两步验证已过期，请重新登录"})
+		return
+	}
+	if input.RecoveryCode != "" {
+		log.Printf("用户 %s 使用恢复码登录", user.Username)
+	}
+	completeLogin(ctx, c, user)
+}
+
+// EnrollMFA 生成新的 TOTP 密钥，确认之前不会生效；已开启两步验证时需要先关闭
+func EnrollMFA(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(409, gin.H{"code": 40906, "error": "已开启两步验证"})
+		return
+	}
+
+	key, err := utils.NewTOTPKey(user.Username)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50006, "error": "生成密钥失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Generate TOTP key error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	qrCode, err := utils.TOTPQRCode(key)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50006, "error": "生成密钥失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Generate TOTP QR code error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := config.Store.Users.SetMFA(ctx, user.Username, key.Secret(), false); err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "保存密钥失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Save TOTP secret error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"code":        20000,
+		"message":     "请使用身份验证器扫描二维码，并提交验证码完成设置",
+		"secret":      key.Secret(),
+		"otpauth_url": key.URL(),
+		"qr_code":     qrCode,
+	})
+}
+
+// ConfirmMFA 提交身份验证器中的验证码以开启两步验证，返回一组只显示一次的恢复码
+func ConfirmMFA(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(409, gin.H{"code": 40906, "error": "已开启两步验证"})
+		return
+	}
+	if user.MFASecret == "" {
+		c.JSON(400, gin.H{"code": 40012, "error": "请先生成两步验证密钥"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	valid, err := utils.ValidateTOTP(ctx, user, input.Code)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Confirm MFA verify error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if !valid {
+		c.JSON(400, gin.H{"code": 40011, "error": "验证码错误"})
+		return
+	}
+
+	codes, err := utils.NewRecoveryCodes(ctx, user.Username)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50006, "error": "生成恢复码失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Generate recovery codes error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if err := config.Store.Users.SetMFA(ctx, user.Username, user.MFASecret, true); err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "开启两步验证失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Enable MFA error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+
+	c.JSON(200, gin.H{"code": 20000, "message": "已开启两步验证，请妥善保存恢复码", "recovery_codes": codes})
+}
+
+// DisableMFA 关闭两步验证，需要提供密码和验证码（或恢复码）
+func DisableMFA(c *gin.Context) {
+	var input struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil || (input.Code == "" && input.RecoveryCode == "") {
+		c.JSON(400, gin.H{"code": 40001, "error": "参数错误"})
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(409, gin.H{"code": 40907, "error": "未开启两步验证"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 与登录共用失败计数，避免持有访问令牌的人猜测密码或验证码
+	wait, err := utils.LoginRetryAfter(ctx, user.Username, c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Disable MFA throttle lookup error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if wait > 0 {
+		tooManyLoginAttempts(c, wait)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)) != nil {
+		loginFailed(ctx, c, user.Username, 40002, "密码错误")
+		return
+	}
+	valid, err := checkSecondFactor(ctx, user, input.Code, input.RecoveryCode)
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Disable MFA verify error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	if !valid {
+		loginFailed(ctx, c, user.Username, 40011, "验证码错误")
+		return
+	}
+
+	if err := clearMFA(ctx, user.Username); err != nil {
+		c.JSON(500, gin.H{"code": 50003, "error": "关闭两步验证失败"})
+		utils.Logger(user.Username, fmt.Sprintf("Disable MFA error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return
+	}
+	c.JSON(200, gin.H{"code": 20000, "message": "已关闭两步验证"})
+}
+
+// ResetMFA 关闭用户的两步验证并删除恢复码，用于用户丢失身份验证器时（仅管理员）
+func ResetMFA(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	username := c.Param("username")
+	err := clearMFA(ctx, username)
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40404, "error": "用户不存在"})
+		return
+	}
+	if err != nil {
+		logID, _ := utils.Logger(c.GetString("username"), fmt.Sprintf("Reset MFA error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		c.JSON(500, gin.H{"code": 50003, "error": "重置两步验证失败", "eventID": logID})
+		return
+	}
+	utils.Logger(c.GetString("username"), fmt.Sprintf("Reset MFA for %s", username), time.Now().Format(time.RFC3339), c.ClientIP())
+	c.JSON(200, gin.H{"code": 20000, "message": "已重置两步验证", "username": username})
+}
+
+func clearMFA(ctx context.Context, username string) error {
+	if err := config.Store.Users.SetMFA(ctx, username, "", false); err != nil {
+		return err
+	}
+	return config.Store.Tokens.DeleteRecoveryCodes(ctx, username)
+}
+
+// 查询当前登录用户，失败时已写好响应
+func loadCurrentUser(c *gin.Context) (*models.Register, bool) {
+	username := c.GetString("username")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := config.Store.Users.GetByUsername(ctx, username)
+	if err == store.ErrNotFound {
+		c.JSON(404, gin.H{"code": 40404, "error": "用户不存在"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"code": 50000, "error": "数据库查询失败"})
+		utils.Logger(username, fmt.Sprintf("Load user error: %v", err), time.Now().Format(time.RFC3339), c.ClientIP())
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"talkFlow/config"
+	"talkFlow/store"
+	"talkFlow/utils"
+)
+
+// 所有请求都校验完令牌、开始使用恢复码后才放行，让并发请求一定交错
+type barrierTokens struct {
+	store.TokenStore
+	arrived *sync.WaitGroup
+}
+
+func (b *barrierTokens) UseRecoveryCode(ctx context.Context, username, codeHash string) (bool, error) {
+	b.arrived.Done()
+	b.arrived.Wait()
+	return b.TokenStore.UseRecoveryCode(ctx, username, codeHash)
+}
+
+// 同一个 mfa_token 并发提交不同的恢复码，只能换到一组令牌
+func TestVerifyMFATokenUsedOnce(t *testing.T) {
+	r, _ := newTestEnv(t)
+	r.POST("/api/v1/auth/mfa", VerifyMFA)
+	createUser(t, "alice", "alice@example.com", true)
+	ctx := context.Background()
+	if err := config.Store.Users.SetMFA(ctx, "alice", "JBSWY3DPEHPK3PXP", true); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := utils.NewRecoveryCodes(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaToken, _, err := utils.GenerateMFAToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	arrived := &sync.WaitGroup{}
+	arrived.Add(len(codes))
+	config.Store.Tokens = &barrierTokens{config.Store.Tokens, arrived}
+
+	results := make([]struct {
+		status int
+		code   int
+	}, len(codes))
+	var wg sync.WaitGroup
+	for i, code := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]string{"mfa_token": mfaToken, "recovery_code": code})
+			req := httptest.NewRequest("POST", "/api/v1/auth/mfa", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			var resp struct {
+				Code int `json:"code"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			results[i].status, results[i].code = w.Code, resp.Code
+		}()
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, res := range results {
+		switch {
+		case res.status == 200:
+			ok++
+		case res.status != 401 || res.code != 40010:
+			t.Fatalf("状态码 %d、code %d，期望 200 或 401 40010", res.status, res.code)
+		}
+	}
+	if ok != 1 {
+		t.Fatalf("同一个 mfa_token 换到了 %d 组令牌，期望 1", ok)
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邮箱验证确认页面的内容
+type verifyPage struct {
+	Token   string // 待提交的令牌，Done 为 false 时使用
+	Done    bool   // 已提交，显示结果
+	OK      bool
+	Message string
+}
+
+var verifyPageTemplate = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>验证邮箱 - talkFlow</title>
+</head>
+<body>
+<h1>验证邮箱</h1>
+{{if .Done}}
+<p>{{.Message}}</p>
+{{else if .Token}}
+<p>点击下面的按钮完成 talkFlow 邮箱验证。</p>
+<form method="post" action="/api/v1/auth/verify">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">确认验证</button>
+</form>
+{{else}}
+<p>验证链接无效或已过期</p>
+{{end}}
+</body>
+</html>
+`))
+
+func renderVerifyPage(c *gin.Context, status int, page verifyPage) {
+	var buf bytes.Buffer
+	if err := verifyPageTemplate.Execute(&buf, page); err != nil {
+		log.Printf("渲染邮箱验证页面失败: %v", err)
+		c.Status(500)
+		return
+	}
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
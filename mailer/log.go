@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// 不真正发送的实现：dir 为空时打印到日志，否则每封邮件保存为 dir 下的一个 .eml 文件
+type logMailer struct {
+	from string
+	dir  string
+}
+
+func NewLog(from, dir string) (Mailer, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &logMailer{from: from, dir: dir}, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+func (m *logMailer) Send(ctx context.Context, msg Message) error {
+	if m.dir == "" {
+		log.Printf("邮件（未发送）收件人: %s 主题: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.dir, name), compose(m.from, msg), 0600)
+}
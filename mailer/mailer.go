@@ -0,0 +1,18 @@
+// Package mailer 发送系统邮件（邮箱验证、重置密码）。
+//
+// 生产环境使用 SMTP，开发和测试时可以使用 Log 将邮件写入日志或目录，也可以用 SMTP 连接
+// MailHog 之类的本地收信服务。
+package mailer
+
+import "context"
+
+// 纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -1,41 +1,147 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"talkFlow/api"
 	"talkFlow/config"
 	"talkFlow/controllers"
 	"talkFlow/middleware" // JWT中间件
+	"talkFlow/models"
+	"talkFlow/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	config.InitEnv()
-	config.InitSQLite()
-	config.InitTables()
+	config.InitDatabase()
+
+	// 数据库迁移命令：talkFlow migrate [up|down [n]|status]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	config.RunMigrations()
+	config.InitAdmin()
+	config.InitWebRTC()
+	config.InitRecording()
+	config.InitSession()
+	config.InitBackpressure()
+	config.InitWebSocket()
+	config.InitBroker()
+	config.InitServer()
+	config.InitMail()
+	config.InitThrottle()
+	config.InitJoinGuard()
+	config.InitJoinCode()
+	config.InitMFA()
+	api.InitSFU()
+	api.InitWebSocket()
 
 	r := gin.Default()
 
 	r.POST("/api/v1/auth/register", controllers.Register)
 	r.POST("/api/v1/auth/login", controllers.Login)
+	r.POST("/api/v1/auth/refresh", controllers.Refresh)
+	r.POST("/api/v1/auth/logout", middleware.JWTAuth(), controllers.Logout)
+	// 邮箱验证和重置密码
+	r.GET("/api/v1/auth/verify", controllers.VerifyEmailPage)
+	r.POST("/api/v1/auth/verify", controllers.VerifyEmail)
+	r.POST("/api/v1/auth/verify/resend", middleware.JWTAuth(), controllers.ResendVerification)
+	r.POST("/api/v1/auth/forgot-password", controllers.ForgotPassword)
+	r.POST("/api/v1/auth/reset-password", controllers.ResetPassword)
+	// 两步验证
+	r.POST("/api/v1/auth/mfa", controllers.VerifyMFA)
+	r.POST("/api/v1/auth/mfa/enroll", middleware.JWTAuth(), controllers.EnrollMFA)
+	r.POST("/api/v1/auth/mfa/confirm", middleware.JWTAuth(), controllers.ConfirmMFA)
+	r.POST("/api/v1/auth/mfa/disable", middleware.JWTAuth(), controllers.DisableMFA)
+
+	// 用户角色管理（仅管理员）
+	admin := r.Group("/api/v1/admin", middleware.JWTAuth(), middleware.RequireRole(models.RoleAdmin))
+	admin.GET("/users", controllers.ListUsers)
+	admin.PUT("/users/:username/role", controllers.GrantRole)
+	admin.DELETE("/users/:username/role", controllers.RevokeRole)
+	admin.DELETE("/users/:username/mfa", controllers.ResetMFA)
+	// 登录锁定，scope 为 user 或 ip
+	admin.GET("/lockouts", controllers.ListLockouts)
+	admin.DELETE("/lockouts/:scope/:key", controllers.ClearLockout)
+	// 加入码校验失败记录
+	admin.GET("/join-failures", controllers.ListJoinFailures)
 
 	// 获取用户信息
 	r.GET("/api/v1/profile", middleware.JWTAuth(), api.GetProfile)
 
-	// 创建房间
-	r.POST("/api/v1/room/create", middleware.JWTAuth(), api.CreateRoom)
-	// 加入房间
-	r.POST("/api/v1/room/join", api.JoinRoom)
+	// 创建房间（房主及以上角色，开启 REQUIRE_EMAIL_VERIFIED 时还需已验证邮箱）
+	r.POST("/api/v1/room/create", middleware.JWTAuth(), middleware.RequireRole(models.RoleHost), middleware.RequireVerifiedEmail(), api.CreateRoom)
+	// 加入房间，房主带上 Auth 鉴权时获得管理权限
+	r.POST("/api/v1/room/join", middleware.OptionalJWTAuth(), api.JoinRoom)
+	// 房间在线成员，需要入场凭证或房主的 Auth 鉴权
+	r.GET("/api/v1/room/:code/participants", middleware.OptionalJWTAuth(), api.GetParticipants)
+
+	// 房间管理（仅房主）
+	r.POST("/api/v1/room/:code/end", middleware.JWTAuth(), api.EndRoom)
+	r.POST("/api/v1/room/:code/extend", middleware.JWTAuth(), api.ExtendRoom)
+	r.POST("/api/v1/room/:code/lock", middleware.JWTAuth(), api.LockRoom)
+	r.POST("/api/v1/room/:code/participants/:user_id/mute", middleware.JWTAuth(), api.MuteParticipant)
+	r.POST("/api/v1/room/:code/participants/:user_id/kick", middleware.JWTAuth(), api.KickParticipant)
+	r.POST("/api/v1/room/:code/bans", middleware.JWTAuth(), api.BanParticipant)
+	r.GET("/api/v1/room/:code/bans", middleware.JWTAuth(), api.ListBans)
+	r.DELETE("/api/v1/room/:code/bans/:id", middleware.JWTAuth(), api.DeleteBan)
+	r.GET("/api/v1/room/:code/stats", middleware.JWTAuth(), api.GetRoomStats)
+
+	// 录音（仅房主）
+	r.POST("/api/v1/room/:code/recording/start", middleware.JWTAuth(), api.StartRecording)
+	r.POST("/api/v1/room/:code/recording/stop", middleware.JWTAuth(), api.StopRecording)
+	r.GET("/api/v1/room/:code/recordings", middleware.JWTAuth(), api.ListRecordings)
+	r.GET("/api/v1/recordings/:id/download", middleware.JWTAuth(), api.DownloadRecording)
+	r.DELETE("/api/v1/recordings/:id", middleware.JWTAuth(), api.DeleteRecording)
 
 	// ws
 	r.GET("/api/v1/ws", api.TalkHandler)
-	// 清除僵尸房间
-	api.StartRoomCleaner()
+	// 清除过期令牌
+	utils.StartTokenCleaner()
 
 	// 测试页面
 	r.StaticFile("/chat.html", "./test/chat.html")
 	r.GET("/api/v1/ws-test", api.TestWSHandler)
 	r.StaticFile("/ws.html", "./test/ws.html")
 
-	r.Run(":8080")
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP 服务启动失败: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	shutdown(srv)
+}
+
+// 依次停止接受新请求、断开 WebSocket 连接、等待后台邮件发送完成、关闭 broker，最后关闭数据库
+func shutdown(srv *http.Server) {
+	log.Println("正在关闭服务...")
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("关闭 HTTP 服务时出错：%v", err)
+	}
+	if err := api.Shutdown(ctx); err != nil {
+		log.Printf("等待 WebSocket 连接关闭超时：%v", err)
+	}
+	if err := controllers.WaitMail(ctx); err != nil {
+		log.Printf("等待邮件发送完成超时：%v", err)
+	}
+	config.CloseBroker()
+	config.CloseDatabase()
+	log.Println("服务已关闭.")
 }
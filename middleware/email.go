@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"talkFlow/config"
+	"talkFlow/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail 开启 REQUIRE_EMAIL_VERIFIED 时要求当前用户已验证邮箱（管理员除外），需放在 JWTAuth 之后
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.RequireEmailVerified {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		user, err := config.Store.Users.GetByUsername(ctx, c.GetString("username"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 50000, "error": "数据库查询失败"})
+			log.Printf("查询用户邮箱验证状态失败: %v", err)
+			c.Abort()
+			return
+		}
+		if !user.EmailVerified && user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"code": 40306, "error": "请先验证邮箱"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
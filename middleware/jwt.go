@@ -1,8 +1,11 @@
 package middleware
 
 import (
+	"context"
+	"log"
 	"net/http"
 	"talkFlow/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -10,28 +13,93 @@ import (
 
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr := c.GetHeader("Authorization")
-		if tokenStr == "" {
+		if c.GetHeader("Authorization") == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"code": 40001, "error": "未提供 token"})
 			c.Abort()
 			return
 		}
-
-		token, err := utils.ParseToken(tokenStr)
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 40002, "error": "无效 token"})
-			c.Abort()
-			return
+		if authenticate(c) {
+			c.Next()
 		}
+	}
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 40003, "error": "无效 token"})
-			c.Abort()
-			return
+// OptionalJWTAuth 允许匿名访问；带了 token 时与 JWTAuth 一样校验，无效的 token 仍会被拒绝
+func OptionalJWTAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" || authenticate(c) {
+			c.Next()
 		}
+	}
+}
+
+// 校验访问令牌并写入上下文，失败时已写好响应并中止请求
+func authenticate(c *gin.Context) bool {
+	token, err := utils.ParseToken(c.GetHeader("Authorization"))
+	if err != nil || !token.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40002, "error": "无效 token"})
+		c.Abort()
+		return false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40003, "error": "无效 token"})
+		c.Abort()
+		return false
+	}
+
+	// 只接受访问令牌，且必须带有 jti 才能被吊销
+	jti, _ := claims["jti"].(string)
+	if typ, _ := claims["typ"].(string); typ != utils.TokenTypeAccess || jti == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40003, "error": "无效 token"})
+		c.Abort()
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := utils.IsJTIRevoked(ctx, jti)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 50000, "error": "数据库查询失败"})
+		log.Printf("查询令牌黑名单失败: %v", err)
+		c.Abort()
+		return false
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40004, "error": "token 已失效"})
+		c.Abort()
+		return false
+	}
+
+	// 重置密码之前签发的令牌全部失效
+	username, _ := claims["username"].(string)
+	iat, _ := claims.GetIssuedAt()
+	if iat == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40003, "error": "无效 token"})
+		c.Abort()
+		return false
+	}
+	stale, err := utils.IssuedBeforePasswordReset(ctx, username, iat.Time)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 50000, "error": "数据库查询失败"})
+		log.Printf("查询用户失败: %v", err)
+		c.Abort()
+		return false
+	}
+	if stale {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 40004, "error": "token 已失效"})
+		c.Abort()
+		return false
+	}
+
+	exp, _ := claims.GetExpirationTime()
 
-		c.Set("username", claims["username"])
-		c.Next()
+	c.Set("username", claims["username"])
+	c.Set("jti", jti)
+	if exp != nil {
+		c.Set("token_exp", exp.Time)
 	}
+	return true
 }
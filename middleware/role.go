@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole 要求当前用户至少具备 required 角色，需放在 JWTAuth 之后。
+// 角色每次从数据库读取，授予或收回后立即生效，无需重新登录。
+func RequireRole(required models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username := c.GetString("username")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		user, err := config.Store.Users.GetByUsername(ctx, username)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 40003, "error": "无效 token"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 50000, "error": "数据库查询失败"})
+			log.Printf("查询用户角色失败: %v", err)
+			c.Abort()
+			return
+		}
+
+		if !user.Role.AtLeast(required) {
+			c.JSON(http.StatusForbidden, gin.H{"code": 40303, "error": "权限不足"})
+			c.Abort()
+			return
+		}
+
+		c.Set("role", user.Role)
+		c.Next()
+	}
+}
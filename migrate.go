@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"talkFlow/config"
+)
+
+const migrateUsage = `用法:
+  talkFlow migrate up          执行所有未执行的迁移
+  talkFlow migrate down [n]    回滚最近的 n 个迁移（默认 1）
+  talkFlow migrate status      查看迁移状态`
+
+func runMigrate(args []string) {
+	migrator := config.Store.Migrations
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := "up"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case "up":
+		count, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
+		fmt.Printf("已执行 %d 个迁移\n", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				fmt.Println(migrateUsage)
+				os.Exit(2)
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("回滚迁移失败: %v", err)
+		}
+		fmt.Printf("已回滚 %d 个迁移\n", count)
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("读取迁移状态失败: %v", err)
+		}
+		for _, s := range list {
+			state := "未执行"
+			if s.Applied {
+				state = "已执行 " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Println(migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// 迁移系统引入前，表结构由 config.InitTables 用 CREATE TABLE IF NOT EXISTS 创建，
+// 之后新增的列是启动时通过 ALTER TABLE 补上的。基线迁移只能补齐缺失的表，
+// 所以对这类旧数据库先补齐缺失的列，再执行基线迁移。
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"rooms", "media_mode", "TEXT NOT NULL DEFAULT 'mesh'"},
+}
+
+func adoptLegacy(ctx context.Context, db *sql.DB) error {
+	for _, col := range legacyColumns {
+		columns, err := tableColumns(ctx, db, col.table)
+		if err != nil {
+			return err
+		}
+		// 表不存在说明是全新的数据库，交给基线迁移创建
+		if len(columns) == 0 || columns[col.column] {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("为 %s 表添加 %s 列失败: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+table+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
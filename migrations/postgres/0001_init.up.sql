@@ -0,0 +1,72 @@
+-- 基线：与 SQLite 的 0001_init 表结构一致
+CREATE TABLE IF NOT EXISTS register (
+    id BIGSERIAL PRIMARY KEY,
+    username TEXT UNIQUE,
+    password TEXT,
+    email TEXT,
+    avatar TEXT,
+    created_at TIMESTAMPTZ,
+    register_ip TEXT,
+    is_register BOOLEAN,
+    last_login_ip TEXT,
+    last_login_time TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS visitor (
+    id BIGSERIAL PRIMARY KEY,
+    visitor_id TEXT,
+    created_at TIMESTAMPTZ,
+    visitor_ip TEXT,
+    is_register BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS log (
+    id BIGSERIAL PRIMARY KEY,
+    username TEXT,
+    error TEXT,
+    timestamp TEXT,
+    ip TEXT
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT,
+    creater TEXT,
+    joiner TEXT,
+    join_code TEXT,
+    create_time TIMESTAMPTZ,
+    expire_time TIMESTAMPTZ,
+    status INTEGER,
+    ip TEXT,
+    media_mode TEXT NOT NULL DEFAULT 'mesh'
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    username TEXT,
+    token_hash TEXT UNIQUE,
+    family TEXT,
+    expires_at TIMESTAMPTZ,
+    revoked BOOLEAN,
+    created_at TIMESTAMPTZ,
+    ip TEXT
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    username TEXT,
+    expires_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS recordings (
+    id BIGSERIAL PRIMARY KEY,
+    room_id BIGINT REFERENCES rooms(id),
+    participant TEXT,
+    format TEXT,
+    file_path TEXT,
+    size BIGINT,
+    started_by TEXT,
+    started_at TIMESTAMPTZ,
+    ended_at TIMESTAMPTZ
+);
@@ -0,0 +1,4 @@
+ALTER TABLE register ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+-- 引入角色之前所有注册用户都可以创建房间，已有用户保留该权限
+UPDATE register SET role = 'host';
@@ -0,0 +1,2 @@
+DROP TABLE email_tokens;
+ALTER TABLE register DROP COLUMN email_verified;
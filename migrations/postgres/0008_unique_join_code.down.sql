@@ -0,0 +1 @@
+DROP INDEX idx_rooms_active_join_code;
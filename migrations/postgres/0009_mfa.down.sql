@@ -0,0 +1,4 @@
+DROP TABLE mfa_recovery_codes;
+ALTER TABLE register DROP COLUMN mfa_last_step;
+ALTER TABLE register DROP COLUMN mfa_enabled;
+ALTER TABLE register DROP COLUMN mfa_secret;
@@ -0,0 +1,15 @@
+-- 两步验证：mfa_secret 在开启前保存待确认的密钥，mfa_last_step 是最近一次使用的验证码时间步，防止重放
+ALTER TABLE register ADD COLUMN mfa_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE register ADD COLUMN mfa_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE register ADD COLUMN mfa_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- 一次性恢复码，只保存哈希
+CREATE TABLE mfa_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    username TEXT NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_mfa_recovery_codes_user ON mfa_recovery_codes (username);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS recordings;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS rooms;
+DROP TABLE IF EXISTS log;
+DROP TABLE IF EXISTS visitor;
+DROP TABLE IF EXISTS register;
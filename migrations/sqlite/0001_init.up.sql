@@ -0,0 +1,72 @@
+-- 基线：与迁移系统引入前 InitTables 创建的表结构一致
+CREATE TABLE IF NOT EXISTS register (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE,
+    password TEXT,
+    email TEXT,
+    avatar TEXT,
+    created_at DATETIME,
+    register_ip TEXT,
+    is_register BOOLEAN,
+    last_login_ip TEXT,
+    last_login_time DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS visitor (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    visitor_id TEXT,
+    created_at DATETIME,
+    visitor_ip TEXT,
+    is_register BOOLEAN
+);
+
+CREATE TABLE IF NOT EXISTS log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT,
+    error TEXT,
+    timestamp TEXT,
+    ip TEXT
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT,
+    creater TEXT,
+    joiner TEXT,
+    join_code TEXT,
+    create_time DATETIME,
+    expire_time DATETIME,
+    status INTEGER,
+    ip TEXT,
+    media_mode TEXT NOT NULL DEFAULT 'mesh'
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT,
+    token_hash TEXT UNIQUE,
+    family TEXT,
+    expires_at DATETIME,
+    revoked BOOLEAN,
+    created_at DATETIME,
+    ip TEXT
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    username TEXT,
+    expires_at DATETIME,
+    revoked_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS recordings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    room_id INTEGER REFERENCES rooms(id),
+    participant TEXT,
+    format TEXT,
+    file_path TEXT,
+    size INTEGER,
+    started_by TEXT,
+    started_at DATETIME,
+    ended_at DATETIME
+);
@@ -0,0 +1,11 @@
+CREATE TABLE room_bans (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    room_id INTEGER NOT NULL REFERENCES rooms(id),
+    visitor_id TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    reason TEXT,
+    banned_by TEXT,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_room_bans_room ON room_bans (room_id);
@@ -0,0 +1,15 @@
+ALTER TABLE register ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 邮箱验证和重置密码的一次性令牌，只保存哈希
+CREATE TABLE email_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_email_tokens_user ON email_tokens (username, purpose);
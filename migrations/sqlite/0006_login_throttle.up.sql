@@ -0,0 +1,9 @@
+-- 按用户名和IP统计的连续登录失败次数，用于登录限流和临时锁定
+CREATE TABLE login_throttles (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure DATETIME NOT NULL,
+    locked_until DATETIME,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,12 @@
+-- 加入码校验失败记录，用于按IP和访客ID限流，以及审计枚举加入码的行为
+CREATE TABLE join_failures (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    join_code TEXT NOT NULL,
+    visitor_id TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_join_failures_ip ON join_failures (ip, created_at);
+CREATE INDEX idx_join_failures_visitor ON join_failures (visitor_id, created_at);
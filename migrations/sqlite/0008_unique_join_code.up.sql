@@ -0,0 +1,5 @@
+-- 同一加入码同时只能有一个进行中的房间；已有的重复房间只保留最新的一个，其余标记为已结束
+UPDATE rooms SET status = 1
+WHERE status = 0 AND id NOT IN (SELECT MAX(id) FROM rooms WHERE status = 0 GROUP BY join_code);
+
+CREATE UNIQUE INDEX idx_rooms_active_join_code ON rooms (join_code) WHERE status = 0;
@@ -0,0 +1 @@
+ALTER TABLE register DROP COLUMN tokens_valid_after;
@@ -0,0 +1,2 @@
+-- 重置密码的时间，在此之前签发的访问令牌全部失效
+ALTER TABLE register ADD COLUMN tokens_valid_after DATETIME;
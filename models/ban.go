@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// 房间封禁记录，按访客ID或IP禁止再次加入，房间结束后自然失效
+type RoomBan struct {
+	ID        int64     `json:"id" db:"id"`
+	RoomID    int64     `json:"room_id" db:"room_id"`
+	VisitorID string    `json:"visitor_id,omitempty" db:"visitor_id"`
+	IP        string    `json:"ip,omitempty" db:"ip"`
+	Reason    string    `json:"reason" db:"reason"`
+	BannedBy  string    `json:"banned_by" db:"banned_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
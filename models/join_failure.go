@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// 加入码校验失败的入口
+const (
+	JoinSourceJoin         = "join"         // POST /room/join
+	JoinSourceWebSocket    = "ws"           // /ws 建立连接或恢复会话
+	JoinSourceParticipants = "participants" // 查询房间在线成员
+)
+
+// 一次加入码校验失败（房间不存在），用于限流和审计枚举加入码的行为
+type JoinFailure struct {
+	ID        int64     `json:"id" db:"id"`
+	JoinCode  string    `json:"join_code" db:"join_code"`
+	VisitorID string    `json:"visitor_id" db:"visitor_id"`
+	IP        string    `json:"ip" db:"ip"`
+	Source    string    `json:"source" db:"source"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// 写入 log 表的错误日志
+type LogEntry struct {
+	Username  string `json:"username" db:"username"`
+	Error     string `json:"error" db:"error"`
+	Timestamp string `json:"timestamp" db:"timestamp"`
+	IP        string `json:"ip" db:"ip"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// 录音文件格式
+const (
+	RecordingWebM = "webm" // WebSocket 中转模式下客户端上传的 MediaRecorder 数据
+	RecordingOgg  = "ogg"  // SFU 模式下由服务端封装的 Opus 音频
+)
+
+// 每个成员在一次录音中对应一个文件
+type Recording struct {
+	ID          int64      `json:"id" db:"id"`
+	RoomID      int64      `json:"room_id" db:"room_id"`
+	Participant string     `json:"participant" db:"participant"`
+	Format      string     `json:"format" db:"format"`
+	FilePath    string     `json:"-" db:"file_path"`
+	Size        int64      `json:"size" db:"size"`
+	StartedBy   string     `json:"started_by" db:"started_by"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	EndedAt     *time.Time `json:"ended_at" db:"ended_at"` // 为空表示仍在录制
+}
+
+func (r *Recording) IsActive() bool {
+	return r.EndedAt == nil
+}
@@ -0,0 +1,26 @@
+package models
+
+// 用户角色，权限依次递增：member < host < admin
+type Role string
+
+const (
+	RoleMember Role = "member" // 注册用户，可以加入房间
+	RoleHost   Role = "host"   // 可以创建房间
+	RoleAdmin  Role = "admin"  // 管理用户角色
+)
+
+var roleLevel = map[Role]int{
+	RoleMember: 1,
+	RoleHost:   2,
+	RoleAdmin:  3,
+}
+
+func (r Role) Valid() bool {
+	_, ok := roleLevel[r]
+	return ok
+}
+
+// 角色是否具备 required 要求的权限，高级角色包含低级角色的权限
+func (r Role) AtLeast(required Role) bool {
+	return r.Valid() && roleLevel[r] >= roleLevel[required]
+}
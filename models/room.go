@@ -11,6 +11,12 @@ const (
 	RoomEnded                     // 1: 已结束
 )
 
+// 房间的音频传输方式
+const (
+	MediaMesh = "mesh" // 成员之间 P2P 直连（或通过 WebSocket 中转）
+	MediaSFU  = "sfu"  // 由服务端内置 SFU 转发，适合人数较多的房间
+)
+
 type Room struct {
 	ID         int64      `json:"id" db:"id"`
 	Name       string     `json:"name" db:"name"`
@@ -22,6 +28,8 @@ type Room struct {
 	ExpireTime time.Time  `json:"expire_time" db:"expire_time"`
 	Status     RoomStatus `json:"status" db:"status"`
 	IP         string     `json:"ip" db:"ip"`
+	MediaMode  string     `json:"media_mode" db:"media_mode"`
+	Locked     bool       `json:"locked" db:"locked"` // 锁定后不再接受新成员加入
 }
 
 func (r *Room) IsOngoing() bool {
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// 限流计数的维度
+const (
+	ThrottleUser       = "user"        // 登录失败，按用户名
+	ThrottleIP         = "ip"          // 登录失败，按客户端IP
+	ThrottleResetEmail = "reset_email" // 重置密码申请，按邮箱
+	ThrottleResetIP    = "reset_ip"    // 重置密码申请，按客户端IP
+)
+
+// 某个维度的计数记录：登录为连续失败次数，重置密码为申请次数
+type LoginThrottle struct {
+	Scope       string     `json:"scope" db:"scope"`
+	Key         string     `json:"key" db:"key"`
+	Failures    int        `json:"failures" db:"failures"`
+	LastFailure time.Time  `json:"last_failure" db:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until" db:"locked_until"` // 为空表示未锁定过
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// 刷新令牌，只保存哈希；同一次登录轮换出的令牌属于同一个 family
+type RefreshToken struct {
+	ID        int64     `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	Family    string    `json:"family" db:"family"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	Revoked   bool      `json:"revoked" db:"revoked"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	IP        string    `json:"ip" db:"ip"`
+}
+
+// 邮件中一次性令牌的用途
+const (
+	EmailTokenVerify = "verify" // 验证邮箱
+	EmailTokenReset  = "reset"  // 重置密码
+)
+
+// 邮箱验证或重置密码令牌，只保存哈希，使用一次后作废
+type EmailToken struct {
+	ID        int64     `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	Email     string    `json:"email" db:"email"` // 签发时的邮箱，验证时必须与当前邮箱一致
+	Purpose   string    `json:"purpose" db:"purpose"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	Used      bool      `json:"used" db:"used"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
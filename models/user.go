@@ -14,8 +14,15 @@ type Register struct {
 	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
 	RegisterIP    string         `json:"register_ip" db:"register_ip"`
 	IsRegister    bool           `json:"is_register" db:"is_register"`
+	Role          Role           `json:"role" db:"role"`
+	EmailVerified bool           `json:"email_verified" db:"email_verified"`
+	MFASecret     string         `json:"-" db:"mfa_secret"` // TOTP 密钥，开启前为待确认的密钥
+	MFAEnabled    bool           `json:"mfa_enabled" db:"mfa_enabled"`
+	MFALastStep   int64          `json:"-" db:"mfa_last_step"` // 最近一次使用的验证码时间步
 	LastLoginIP   sql.NullString `json:"last_login_ip,omitempty" db:"last_login_ip"`
 	LastLoginTime sql.NullTime   `json:"last_login_time,omitempty" db:"last_login_time"`
+	// 最近一次重置密码的时间，在此之前（含同一秒内）签发的访问令牌失效
+	TokensValidAfter sql.NullTime `json:"-" db:"tokens_valid_after"`
 }
 
 type Visitor struct {
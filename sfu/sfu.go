@@ -0,0 +1,391 @@
+// Package sfu 实现内置的选择性转发单元：每个成员与服务端建立一条 WebRTC 连接，
+// 服务端接收其音频轨道并转发给同房间的其他成员，不做混音和转码。
+//
+// 信令由调用方负责传输，协商始终由服务端发起 offer，客户端只需回复 answer，避免双方同时 offer 造成冲突。
+package sfu
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// 信令消息类型，与 WebSocket 协议中的 type 一致
+const (
+	SignalOffer     = "offer"     // payload: webrtc.SessionDescription
+	SignalCandidate = "candidate" // payload: webrtc.ICECandidateInit
+)
+
+var ErrPeerNotFound = errors.New("sfu: peer not found")
+
+// 向某个成员发送信令
+type SignalFunc func(kind string, payload interface{})
+
+// 收到成员上行的 RTP 包时回调，可用于录音；packet 在回调返回后会被复用
+type RTPHandler func(roomID, streamID string, codec webrtc.RTPCodecParameters, packet []byte)
+
+type Config struct {
+	ICEServers []webrtc.ICEServer
+	PublicIPs  []string // 服务器位于 NAT 之后时对外公布的 IP
+	PortMin    uint16   // UDP 端口范围，0 表示由系统分配
+	PortMax    uint16
+	OnRTP      RTPHandler
+}
+
+type Manager struct {
+	api    *webrtc.API
+	config webrtc.Configuration
+	onRTP  RTPHandler
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+func NewManager(cfg Config) (*Manager, error) {
+	settings := webrtc.SettingEngine{}
+	if len(cfg.PublicIPs) > 0 {
+		settings.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	if cfg.PortMin > 0 && cfg.PortMax >= cfg.PortMin {
+		if err := settings.SetEphemeralUDPPortRange(cfg.PortMin, cfg.PortMax); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Manager{
+		api:    webrtc.NewAPI(webrtc.WithSettingEngine(settings)),
+		config: webrtc.Configuration{ICEServers: cfg.ICEServers},
+		onRTP:  cfg.OnRTP,
+		rooms:  make(map[string]*room),
+	}, nil
+}
+
+type room struct {
+	id     string
+	onRTP  RTPHandler
+	mu     sync.Mutex
+	peers  map[string]*peer
+	tracks map[string]*webrtc.TrackLocalStaticRTP // 按发送者ID索引的转发轨道
+}
+
+type peer struct {
+	id      string
+	stream  string // 下发给其他成员的轨道 stream.id
+	pc      *webrtc.PeerConnection
+	signal  atomic.Pointer[SignalFunc]   // 恢复会话后由 Rebind 替换
+	senders map[string]*webrtc.RTPSender // 按轨道来源成员ID索引
+
+	pendingOffer      bool // 协商进行中又有轨道变化，收到 answer 后需要再协商一次
+	pendingCandidates []webrtc.ICECandidateInit
+
+	muted atomic.Bool // 被禁言时丢弃上行音频，不转发也不录制
+}
+
+// 成员加入 SFU：创建 PeerConnection 并下发首个 offer。同一成员重复加入时替换旧连接。
+// peerID 标识一条连接，streamID 是其他成员看到的轨道 stream.id，多条连接可以使用相同的 streamID。
+func (m *Manager) Join(roomID, peerID, streamID string, signal SignalFunc) error {
+	pc, err := m.api.NewPeerConnection(m.config)
+	if err != nil {
+		return err
+	}
+	// 接收成员的麦克风音频
+	if _, err := pc.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		pc.Close()
+		return err
+	}
+
+	p := &peer{
+		id:      peerID,
+		stream:  streamID,
+		pc:      pc,
+		senders: make(map[string]*webrtc.RTPSender),
+	}
+	p.signal.Store(&signal)
+
+	// 加锁顺序与 leave 一致：先 m.mu 后 r.mu
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	if !ok {
+		r = &room{
+			id:     roomID,
+			onRTP:  m.onRTP,
+			peers:  make(map[string]*peer),
+			tracks: make(map[string]*webrtc.TrackLocalStaticRTP),
+		}
+		m.rooms[roomID] = r
+	}
+	r.mu.Lock()
+	old := r.peers[peerID]
+	r.peers[peerID] = p
+	delete(r.tracks, peerID) // 旧连接的上行轨道作废，等待新连接的 OnTrack
+	r.mu.Unlock()
+	m.mu.Unlock()
+
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			p.send(SignalCandidate, c.ToJSON())
+		}
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed {
+			m.leave(r, p)
+		}
+	})
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		r.forward(p, remote)
+	})
+
+	if old != nil {
+		m.leave(r, old)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.syncLocked(p)
+}
+
+// 处理客户端回复的 answer
+func (m *Manager) Answer(roomID, peerID string, answer webrtc.SessionDescription) error {
+	r, p := m.lookup(roomID, peerID)
+	if p == nil {
+		return ErrPeerNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := p.pc.SetRemoteDescription(answer); err != nil {
+		return err
+	}
+	for _, c := range p.pendingCandidates {
+		if err := p.pc.AddICECandidate(c); err != nil {
+			log.Printf("sfu: 添加 ICE 候选失败: %v", err)
+		}
+	}
+	p.pendingCandidates = nil
+
+	if p.pendingOffer {
+		return r.syncLocked(p)
+	}
+	return nil
+}
+
+// 处理客户端发来的 ICE 候选，远端描述尚未设置时先缓存
+func (m *Manager) Candidate(roomID, peerID string, candidate webrtc.ICECandidateInit) error {
+	r, p := m.lookup(roomID, peerID)
+	if p == nil {
+		return ErrPeerNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.pc.RemoteDescription() == nil {
+		p.pendingCandidates = append(p.pendingCandidates, candidate)
+		return nil
+	}
+	return p.pc.AddICECandidate(candidate)
+}
+
+// 成员恢复会话后，信令改发到新的连接，PeerConnection 保持不变。
+// 旧连接可能没有收到最近一次 offer，协商尚未完成时重新下发。
+func (m *Manager) Rebind(roomID, peerID string, signal SignalFunc) error {
+	r, p := m.lookup(roomID, peerID)
+	if p == nil {
+		return ErrPeerNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p.signal.Store(&signal)
+	if p.pc.SignalingState() == webrtc.SignalingStateHaveLocalOffer {
+		if offer := p.pc.LocalDescription(); offer != nil {
+			p.send(SignalOffer, *offer)
+		}
+	}
+	return nil
+}
+
+// 成员离开 SFU
+func (m *Manager) Leave(roomID, peerID string) {
+	r, p := m.lookup(roomID, peerID)
+	if p != nil {
+		m.leave(r, p)
+	}
+}
+
+// 禁言或解除禁言成员，成员尚未加入时返回 ErrPeerNotFound
+func (m *Manager) SetMuted(roomID, peerID string, muted bool) error {
+	_, p := m.lookup(roomID, peerID)
+	if p == nil {
+		return ErrPeerNotFound
+	}
+	p.muted.Store(muted)
+	return nil
+}
+
+func (m *Manager) lookup(roomID, peerID string) (*room, *peer) {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r, r.peers[peerID]
+}
+
+func (m *Manager) leave(r *room, p *peer) {
+	r.mu.Lock()
+	if r.peers[p.id] == p {
+		delete(r.peers, p.id)
+		delete(r.tracks, p.id)
+	}
+	empty := len(r.peers) == 0
+	// 其他成员移除该成员的轨道
+	for _, other := range r.peers {
+		if err := r.syncLocked(other); err != nil {
+			log.Printf("sfu: 重新协商失败: %v", err)
+		}
+	}
+	r.mu.Unlock()
+
+	if err := p.pc.Close(); err != nil {
+		log.Printf("sfu: 关闭 PeerConnection 失败: %v", err)
+	}
+
+	if empty {
+		m.mu.Lock()
+		r.mu.Lock()
+		if len(r.peers) == 0 && m.rooms[r.id] == r {
+			delete(m.rooms, r.id)
+		}
+		r.mu.Unlock()
+		m.mu.Unlock()
+	}
+}
+
+// 将成员上行的音频转发给房间内其他成员
+func (r *room) forward(from *peer, remote *webrtc.TrackRemote) {
+	local, err := webrtc.NewTrackLocalStaticRTP(remote.Codec().RTPCodecCapability, "audio", from.stream)
+	if err != nil {
+		log.Printf("sfu: 创建转发轨道失败: %v", err)
+		return
+	}
+
+	r.mu.Lock()
+	if r.peers[from.id] != from {
+		r.mu.Unlock()
+		return
+	}
+	r.tracks[from.id] = local
+	for _, other := range r.peers {
+		if other != from {
+			if err := r.syncLocked(other); err != nil {
+				log.Printf("sfu: 重新协商失败: %v", err)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	codec := remote.Codec()
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := remote.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("sfu: 读取上行音频结束: %v", err)
+			}
+			return
+		}
+		if from.muted.Load() {
+			continue
+		}
+		if r.onRTP != nil {
+			r.onRTP(r.id, from.stream, codec, buf[:n])
+		}
+		// 写入失败只影响个别下行连接，不中断转发
+		local.Write(buf[:n])
+	}
+}
+
+// 让成员的下行轨道与房间保持一致，有变化时发起协商。调用方需持有 r.mu
+func (r *room) syncLocked(p *peer) error {
+	if p.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+		return nil
+	}
+	// 协商期间发生的变化已经记录在 senders 中，但还没有发出 offer
+	changed := p.pendingOffer || p.pc.LocalDescription() == nil
+
+	for id, sender := range p.senders {
+		// 来源成员已离开，或重连后换了新的轨道
+		if track, ok := r.tracks[id]; !ok || sender.Track() != track {
+			if err := p.pc.RemoveTrack(sender); err != nil {
+				return err
+			}
+			delete(p.senders, id)
+			changed = true
+		}
+	}
+	for id, track := range r.tracks {
+		if id == p.id {
+			continue
+		}
+		if _, ok := p.senders[id]; ok {
+			continue
+		}
+		sender, err := p.pc.AddTrack(track)
+		if err != nil {
+			return err
+		}
+		p.senders[id] = sender
+		changed = true
+		go drainRTCP(sender)
+	}
+
+	if !changed {
+		return nil
+	}
+	return p.negotiateLocked()
+}
+
+func (p *peer) negotiateLocked() error {
+	if p.pc.SignalingState() != webrtc.SignalingStateStable {
+		p.pendingOffer = true
+		return nil
+	}
+	p.pendingOffer = false
+
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+	if err := p.pc.SetLocalDescription(offer); err != nil {
+		return err
+	}
+	p.send(SignalOffer, offer)
+	return nil
+}
+
+func (p *peer) send(kind string, payload interface{}) {
+	(*p.signal.Load())(kind, payload)
+}
+
+// 读取 RTCP 让拦截器（NACK 等）正常工作
+func drainRTCP(sender *webrtc.RTPSender) {
+	buf := make([]byte, 1500)
+	for {
+		if _, _, err := sender.Read(buf); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package sfu
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// 测试中的服务端和客户端都在本机回环地址上建立连接，不依赖外部网络
+
+const testRoom = "ROOM01"
+
+var opusCodec = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}
+
+func loopbackAPI() *webrtc.API {
+	settings := webrtc.SettingEngine{}
+	settings.SetIncludeLoopbackCandidate(true)
+	settings.SetInterfaceFilter(func(name string) bool { return name == "lo" })
+	settings.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	return webrtc.NewAPI(webrtc.WithSettingEngine(settings))
+}
+
+func newTestManager(t *testing.T, onRTP RTPHandler) *Manager {
+	t.Helper()
+	m, err := NewManager(Config{OnRTP: onRTP})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	m.api = loopbackAPI()
+	t.Cleanup(func() {
+		m.mu.Lock()
+		var peers []string
+		for _, r := range m.rooms {
+			r.mu.Lock()
+			for id := range r.peers {
+				peers = append(peers, r.id+"/"+id)
+			}
+			r.mu.Unlock()
+		}
+		m.mu.Unlock()
+		for _, key := range peers {
+			roomID, peerID, _ := strings.Cut(key, "/")
+			m.Leave(roomID, peerID)
+		}
+	})
+	return m
+}
+
+type signalMsg struct {
+	kind    string
+	payload interface{}
+}
+
+// 模拟浏览器端：发送一条 Opus 音轨，回复服务端的 offer，统计收到的各路音频
+type testPeer struct {
+	t      *testing.T
+	m      *Manager
+	id     string
+	pc     *webrtc.PeerConnection
+	track  *webrtc.TrackLocalStaticSample
+	signal chan signalMsg
+	done   chan struct{}
+	offers atomic.Int64
+
+	mu       sync.Mutex
+	received map[string]*atomic.Int64 // 按 stream.id 统计收到的 RTP 包
+}
+
+func newTestPeer(t *testing.T, m *Manager, id string) *testPeer {
+	t.Helper()
+	pc, err := loopbackAPI().NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("NewPeerConnection: %v", err)
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(opusCodec, "audio", id+"-stream")
+	if err != nil {
+		t.Fatalf("NewTrackLocalStaticSample: %v", err)
+	}
+	// 在收到首个 offer 之前添加，回复时与服务端的 recvonly 音频对应
+	sender, err := pc.AddTrack(track)
+	if err != nil {
+		t.Fatalf("AddTrack: %v", err)
+	}
+	go drainRTCP(sender)
+
+	p := &testPeer{
+		t:        t,
+		m:        m,
+		id:       id,
+		pc:       pc,
+		track:    track,
+		signal:   make(chan signalMsg, 64),
+		done:     make(chan struct{}),
+		received: make(map[string]*atomic.Int64),
+	}
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c != nil {
+			m.Candidate(testRoom, id, c.ToJSON())
+		}
+	})
+	pc.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		counter := p.counter(remote.StreamID())
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := remote.Read(buf); err != nil {
+				return
+			}
+			counter.Add(1)
+		}
+	})
+	t.Cleanup(p.close)
+
+	go p.handleSignals()
+	go p.sendAudio()
+	return p
+}
+
+// 服务端在持有房间锁时发出信令，这里只入队，由 handleSignals 异步处理，和 WebSocket 的行为一致
+func (p *testPeer) signalFunc(kind string, payload interface{}) {
+	select {
+	case p.signal <- signalMsg{kind, payload}:
+	case <-p.done:
+	}
+}
+
+func (p *testPeer) join() {
+	p.t.Helper()
+	if err := p.m.Join(testRoom, p.id, p.id+"-stream", p.signalFunc); err != nil {
+		p.t.Fatalf("%s Join: %v", p.id, err)
+	}
+}
+
+func (p *testPeer) handleSignals() {
+	for {
+		select {
+		case msg := <-p.signal:
+			switch msg.kind {
+			case SignalOffer:
+				p.answer(msg.payload.(webrtc.SessionDescription))
+			case SignalCandidate:
+				if err := p.pc.AddICECandidate(msg.payload.(webrtc.ICECandidateInit)); err != nil {
+					p.t.Errorf("%s AddICECandidate: %v", p.id, err)
+				}
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *testPeer) answer(offer webrtc.SessionDescription) {
+	if err := p.pc.SetRemoteDescription(offer); err != nil {
+		p.t.Errorf("%s SetRemoteDescription: %v", p.id, err)
+		return
+	}
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		p.t.Errorf("%s CreateAnswer: %v", p.id, err)
+		return
+	}
+	if err := p.pc.SetLocalDescription(answer); err != nil {
+		p.t.Errorf("%s SetLocalDescription: %v", p.id, err)
+		return
+	}
+	p.offers.Add(1)
+	if err := p.m.Answer(testRoom, p.id, answer); err != nil && err != ErrPeerNotFound {
+		p.t.Errorf("%s Answer: %v", p.id, err)
+	}
+}
+
+// 每 20ms 发送一帧，内容不需要是合法的 Opus，SFU 只转发不解码
+func (p *testPeer) sendAudio() {
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	frame := make([]byte, 60)
+	for {
+		select {
+		case <-ticker.C:
+			p.track.WriteSample(media.Sample{Data: frame, Duration: 20 * time.Millisecond})
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *testPeer) counter(stream string) *atomic.Int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.received[stream]
+	if !ok {
+		c = &atomic.Int64{}
+		p.received[stream] = c
+	}
+	return c
+}
+
+func (p *testPeer) packets(from *testPeer) int64 {
+	return p.counter(from.id + "-stream").Load()
+}
+
+func (p *testPeer) close() {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	close(p.done)
+	p.pc.Close()
+}
+
+// 等待 cond 成立，超时后报错
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 等待 from 的音频到达 to
+func waitForAudio(t *testing.T, to, from *testPeer) {
+	t.Helper()
+	start := to.packets(from)
+	waitFor(t, to.id+" 收到 "+from.id+" 的音频", func() bool {
+		return to.packets(from) > start+10
+	})
+}
+
+// 等待一段时间后确认 from 的音频不再到达 to
+func assertNoAudio(t *testing.T, to, from *testPeer) {
+	t.Helper()
+	// 等待已经在路上的包到达
+	time.Sleep(200 * time.Millisecond)
+	before := to.packets(from)
+	time.Sleep(500 * time.Millisecond)
+	if after := to.packets(from); after != before {
+		t.Fatalf("%s 仍在收到 %s 的音频: %d → %d", to.id, from.id, before, after)
+	}
+}
+
+func (m *Manager) peerCount(roomID string) int {
+	m.mu.Lock()
+	r, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.peers)
+}
+
+func TestJoinForwardsAudioBetweenPeers(t *testing.T) {
+	var recorded sync.Map
+	m := newTestManager(t, func(roomID, streamID string, codec webrtc.RTPCodecParameters, packet []byte) {
+		if roomID != testRoom || codec.MimeType != webrtc.MimeTypeOpus {
+			t.Errorf("OnRTP 参数错误: %s %s", roomID, codec.MimeType)
+		}
+		recorded.Store(streamID, true)
+	})
+
+	a := newTestPeer(t, m, "a")
+	a.join()
+	b := newTestPeer(t, m, "b")
+	b.join()
+
+	waitForAudio(t, b, a)
+	waitForAudio(t, a, b)
+	if got := m.peerCount(testRoom); got != 2 {
+		t.Fatalf("房间成员数 = %d，期望 2", got)
+	}
+	for _, stream := range []string{"a-stream", "b-stream"} {
+		if _, ok := recorded.Load(stream); !ok {
+			t.Errorf("OnRTP 没有收到 %s", stream)
+		}
+	}
+	// 成员收不到自己的音频
+	if n := a.packets(a); n != 0 {
+		t.Errorf("a 收到了自己的音频 %d 包", n)
+	}
+}
+
+func TestLateJoinRenegotiates(t *testing.T) {
+	m := newTestManager(t, nil)
+	a := newTestPeer(t, m, "a")
+	a.join()
+	b := newTestPeer(t, m, "b")
+	b.join()
+	waitForAudio(t, b, a)
+	waitForAudio(t, a, b)
+
+	offersA, offersB := a.offers.Load(), b.offers.Load()
+	c := newTestPeer(t, m, "c")
+	c.join()
+
+	// 已有成员通过重新协商拿到新成员的轨道，新成员也能收到所有人
+	waitForAudio(t, a, c)
+	waitForAudio(t, b, c)
+	waitForAudio(t, c, a)
+	waitForAudio(t, c, b)
+	if a.offers.Load() == offersA || b.offers.Load() == offersB {
+		t.Fatal("已有成员没有收到新的 offer")
+	}
+	// 重新协商不影响原有的转发
+	waitForAudio(t, b, a)
+}
+
+func TestRejoinReplacesPeer(t *testing.T) {
+	m := newTestManager(t, nil)
+	a := newTestPeer(t, m, "a")
+	a.join()
+	b := newTestPeer(t, m, "b")
+	b.join()
+	waitForAudio(t, b, a)
+
+	// 同一成员重新加入（如刷新页面）时替换旧连接，其他成员换到新的轨道
+	a.close()
+	a2 := newTestPeer(t, m, "a")
+	a2.join()
+	waitForAudio(t, b, a2)
+	waitForAudio(t, a2, b)
+	if got := m.peerCount(testRoom); got != 2 {
+		t.Fatalf("房间成员数 = %d，期望 2", got)
+	}
+}
+
+func TestLeaveStopsForwarding(t *testing.T) {
+	m := newTestManager(t, nil)
+	a := newTestPeer(t, m, "a")
+	a.join()
+	b := newTestPeer(t, m, "b")
+	b.join()
+	waitForAudio(t, b, a)
+	waitForAudio(t, a, b)
+
+	offers := b.offers.Load()
+	m.Leave(testRoom, "a")
+
+	// 剩下的成员收到移除轨道的 offer
+	waitFor(t, "b 收到移除轨道的 offer", func() bool { return b.offers.Load() > offers })
+	assertNoAudio(t, b, a)
+	if got := m.peerCount(testRoom); got != 1 {
+		t.Fatalf("房间成员数 = %d，期望 1", got)
+	}
+	if err := m.Answer(testRoom, "a", webrtc.SessionDescription{}); err != ErrPeerNotFound {
+		t.Fatalf("离开后 Answer 返回 %v，期望 ErrPeerNotFound", err)
+	}
+
+	// 最后一人离开后房间被删除
+	m.Leave(testRoom, "b")
+	m.mu.Lock()
+	_, ok := m.rooms[testRoom]
+	m.mu.Unlock()
+	if ok {
+		t.Fatal("房间没人后没有被删除")
+	}
+}
+
+func TestSetMutedDropsAudio(t *testing.T) {
+	var recordedA atomic.Int64
+	m := newTestManager(t, func(roomID, streamID string, codec webrtc.RTPCodecParameters, packet []byte) {
+		if streamID == "a-stream" {
+			recordedA.Add(1)
+		}
+	})
+	a := newTestPeer(t, m, "a")
+	a.join()
+	b := newTestPeer(t, m, "b")
+	b.join()
+	waitForAudio(t, b, a)
+
+	if err := m.SetMuted(testRoom, "a", true); err != nil {
+		t.Fatalf("SetMuted: %v", err)
+	}
+	// 被禁言成员的音频既不转发也不录制
+	time.Sleep(100 * time.Millisecond)
+	recorded := recordedA.Load()
+	assertNoAudio(t, b, a)
+	if recordedA.Load() != recorded {
+		t.Fatal("被禁言成员的音频仍在录制")
+	}
+	// 其他成员不受影响
+	waitForAudio(t, a, b)
+
+	if err := m.SetMuted(testRoom, "a", false); err != nil {
+		t.Fatalf("SetMuted: %v", err)
+	}
+	waitForAudio(t, b, a)
+
+	if err := m.SetMuted(testRoom, "nobody", true); err != ErrPeerNotFound {
+		t.Fatalf("SetMuted 不存在的成员返回 %v，期望 ErrPeerNotFound", err)
+	}
+}
+
+// 恢复会话：旧连接收不到信令，Rebind 后重新下发未完成的 offer，之后的协商也发给新连接
+func TestRebindRedirectsSignals(t *testing.T) {
+	m := newTestManager(t, nil)
+	a := newTestPeer(t, m, "a")
+	var lost atomic.Int64
+	if err := m.Join(testRoom, "a", "a-stream", func(string, interface{}) { lost.Add(1) }); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	waitFor(t, "首个 offer 发给旧连接", func() bool { return lost.Load() > 0 })
+
+	if err := m.Rebind(testRoom, "a", a.signalFunc); err != nil {
+		t.Fatalf("Rebind: %v", err)
+	}
+	waitFor(t, "a 收到重新下发的 offer", func() bool { return a.offers.Load() > 0 })
+
+	lostBefore := lost.Load()
+	b := newTestPeer(t, m, "b")
+	b.join()
+	waitForAudio(t, b, a)
+	waitForAudio(t, a, b)
+	if a.offers.Load() < 2 {
+		t.Fatal("b 加入后 a 没有收到重新协商的 offer")
+	}
+	if lost.Load() != lostBefore {
+		t.Fatal("Rebind 后仍有信令发给旧连接")
+	}
+
+	if err := m.Rebind(testRoom, "nobody", a.signalFunc); err != ErrPeerNotFound {
+		t.Fatalf("Rebind 不存在的成员返回 %v，期望 ErrPeerNotFound", err)
+	}
+}
@@ -0,0 +1,804 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"talkFlow/models"
+)
+
+// 内存实现，数据只保存在进程内，用于测试。
+// 行为与 SQL 实现一致（唯一约束、条件更新、排序），读取时返回副本，调用方修改结果不会影响已保存的数据。
+type memoryDB struct {
+	mu     sync.Mutex
+	nextID int64
+
+	users         map[string]*models.Register // 按用户名索引
+	rooms         map[int64]*models.Room
+	visitors      []models.Visitor
+	logs          []models.LogEntry
+	refreshTokens map[int64]*models.RefreshToken
+	revokedJTIs   map[string]time.Time // jti → 过期时间
+	emailTokens   map[int64]*models.EmailToken
+	recoveryCodes map[string]*recoveryCode // 按哈希索引
+	recordings    map[int64]*models.Recording
+	bans          map[int64]*models.RoomBan
+	throttles     map[throttleKey]*models.LoginThrottle
+	joinFailures  []models.JoinFailure
+}
+
+type recoveryCode struct {
+	username string
+	used     bool
+}
+
+type throttleKey struct {
+	scope, key string
+}
+
+// 创建空的内存实现，不需要执行迁移
+func NewMemory() *Store {
+	db := &memoryDB{
+		users:         make(map[string]*models.Register),
+		rooms:         make(map[int64]*models.Room),
+		refreshTokens: make(map[int64]*models.RefreshToken),
+		revokedJTIs:   make(map[string]time.Time),
+		emailTokens:   make(map[int64]*models.EmailToken),
+		recoveryCodes: make(map[string]*recoveryCode),
+		recordings:    make(map[int64]*models.Recording),
+		bans:          make(map[int64]*models.RoomBan),
+		throttles:     make(map[throttleKey]*models.LoginThrottle),
+	}
+	return &Store{
+		Users:        &memUserStore{db},
+		Rooms:        &memRoomStore{db},
+		Visitors:     &memVisitorStore{db},
+		Logs:         &memLogStore{db},
+		Tokens:       &memTokenStore{db},
+		Recordings:   &memRecordingStore{db},
+		Bans:         &memBanStore{db},
+		Throttles:    &memThrottleStore{db},
+		JoinFailures: &memJoinFailureStore{db},
+	}
+}
+
+// 所有表共用一个自增序列，调用方需持有 mu
+func (d *memoryDB) newID() int64 {
+	d.nextID++
+	return d.nextID
+}
+
+type memUserStore struct{ *memoryDB }
+
+func (s *memUserStore) Create(ctx context.Context, user *models.Register) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Username]; ok {
+		return ErrDuplicate
+	}
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	user.ID = s.newID()
+	saved := *user
+	s.users[user.Username] = &saved
+	return nil
+}
+
+func (s *memUserStore) GetByUsername(ctx context.Context, username string) (*models.Register, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *user
+	return &found, nil
+}
+
+func (s *memUserStore) UpdateLastLogin(ctx context.Context, id int64, ip string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			user.LastLoginIP.String, user.LastLoginIP.Valid = ip, true
+			user.LastLoginTime.Time, user.LastLoginTime.Valid = at, true
+		}
+	}
+	return nil
+}
+
+func (s *memUserStore) List(ctx context.Context) ([]models.Register, error) {
+	return s.list(func(*models.Register) bool { return true }), nil
+}
+
+func (s *memUserStore) ListByEmail(ctx context.Context, email string) ([]models.Register, error) {
+	return s.list(func(user *models.Register) bool {
+		return strings.EqualFold(user.Email, email)
+	}), nil
+}
+
+// 按ID排序返回符合条件的用户
+func (s *memUserStore) list(match func(*models.Register) bool) []models.Register {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []models.Register{}
+	for _, user := range s.users {
+		if match(user) {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+func (s *memUserStore) SetRole(ctx context.Context, username string, role models.Role) error {
+	return s.updateUser(username, func(user *models.Register) { user.Role = role })
+}
+
+func (s *memUserStore) SetEmailVerified(ctx context.Context, username string, verified bool) error {
+	return s.updateUser(username, func(user *models.Register) { user.EmailVerified = verified })
+}
+
+func (s *memUserStore) UpdatePassword(ctx context.Context, username, passwordHash string, at time.Time) error {
+	return s.updateUser(username, func(user *models.Register) {
+		user.Password = passwordHash
+		user.TokensValidAfter.Time, user.TokensValidAfter.Valid = at, true
+	})
+}
+
+func (s *memUserStore) SetMFA(ctx context.Context, username, secret string, enabled bool) error {
+	return s.updateUser(username, func(user *models.Register) {
+		if user.MFASecret != secret {
+			user.MFALastStep = 0
+		}
+		user.MFASecret = secret
+		user.MFAEnabled = enabled
+	})
+}
+
+func (s *memUserStore) UseMFAStep(ctx context.Context, username string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok || user.MFALastStep >= step {
+		return false, nil
+	}
+	user.MFALastStep = step
+	return true, nil
+}
+
+// 修改一个用户，用户不存在时返回 ErrNotFound
+func (s *memUserStore) updateUser(username string, update func(*models.Register)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	update(user)
+	return nil
+}
+
+func (s *memUserStore) CountByRole(ctx context.Context, role models.Role) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, user := range s.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type memVisitorStore struct{ *memoryDB }
+
+func (s *memVisitorStore) Create(ctx context.Context, visitor *models.Visitor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	visitor.ID = s.newID()
+	s.visitors = append(s.visitors, *visitor)
+	return nil
+}
+
+type memLogStore struct{ *memoryDB }
+
+func (s *memLogStore) Insert(ctx context.Context, entry *models.LogEntry) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logs = append(s.logs, *entry)
+	return s.newID(), nil
+}
+
+type memRoomStore struct{ *memoryDB }
+
+func copyRoom(room *models.Room) *models.Room {
+	found := *room
+	found.Joiner = strings.Split(room.JoinerStr, ",")
+	return &found
+}
+
+func (s *memRoomStore) Create(ctx context.Context, room *models.Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 与 idx_rooms_active_join_code 一致：进行中的房间加入码唯一
+	if room.Status == models.RoomOngoing {
+		for _, other := range s.rooms {
+			if other.JoinCode == room.JoinCode && other.Status == models.RoomOngoing {
+				return ErrDuplicate
+			}
+		}
+	}
+	room.JoinerStr = strings.Join(room.Joiner, ",")
+	room.ID = s.newID()
+	s.rooms[room.ID] = copyRoom(room)
+	return nil
+}
+
+func (s *memRoomStore) GetByID(ctx context.Context, id int64) (*models.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyRoom(room), nil
+}
+
+func (s *memRoomStore) GetByJoinCode(ctx context.Context, joinCode string) (*models.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *models.Room
+	for _, room := range s.rooms {
+		if room.JoinCode != joinCode {
+			continue
+		}
+		if best == nil {
+			best = room
+			continue
+		}
+		bestOngoing, ongoing := best.Status == models.RoomOngoing, room.Status == models.RoomOngoing
+		if ongoing && !bestOngoing || ongoing == bestOngoing && room.ID > best.ID {
+			best = room
+		}
+	}
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return copyRoom(best), nil
+}
+
+func (s *memRoomStore) EndExpired(ctx context.Context, joinCode string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ended := false
+	for _, room := range s.rooms {
+		if room.JoinCode == joinCode && room.Status == models.RoomOngoing && room.ExpireTime.Before(now) {
+			room.Status = models.RoomEnded
+			ended = true
+		}
+	}
+	return ended, nil
+}
+
+func (s *memRoomStore) UpdateStatus(ctx context.Context, id int64, status models.RoomStatus) error {
+	return s.updateRoom(id, func(room *models.Room) { room.Status = status })
+}
+
+func (s *memRoomStore) UpdateExpireTime(ctx context.Context, id int64, expireTime time.Time) error {
+	return s.updateRoom(id, func(room *models.Room) { room.ExpireTime = expireTime })
+}
+
+func (s *memRoomStore) SetLocked(ctx context.Context, id int64, locked bool) error {
+	return s.updateRoom(id, func(room *models.Room) { room.Locked = locked })
+}
+
+// 与 SQL 实现一致，房间不存在时不报错
+func (s *memRoomStore) updateRoom(id int64, update func(*models.Room)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if room, ok := s.rooms[id]; ok {
+		update(room)
+	}
+	return nil
+}
+
+type memTokenStore struct{ *memoryDB }
+
+func (s *memTokenStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	token.ID = s.newID()
+	saved := *token
+	s.refreshTokens[token.ID] = &saved
+	return nil
+}
+
+func (s *memTokenStore) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.TokenHash == tokenHash {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTokenStore) RevokeRefreshToken(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.refreshTokens[id]
+	if !ok || t.Revoked {
+		return false, nil
+	}
+	t.Revoked = true
+	return true, nil
+}
+
+func (s *memTokenStore) RevokeRefreshFamily(ctx context.Context, family string) error {
+	s.revokeRefresh(func(t *models.RefreshToken) bool { return t.Family == family })
+	return nil
+}
+
+func (s *memTokenStore) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	s.revokeRefresh(func(t *models.RefreshToken) bool { return t.Username == username })
+	return nil
+}
+
+func (s *memTokenStore) revokeRefresh(match func(*models.RefreshToken) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if match(t) {
+			t.Revoked = true
+		}
+	}
+}
+
+func (s *memTokenStore) RevokeJTI(ctx context.Context, jti, username string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedJTIs[jti]; !ok {
+		s.revokedJTIs[jti] = expiresAt
+	}
+	return nil
+}
+
+func (s *memTokenStore) ConsumeJTI(ctx context.Context, jti, username string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revokedJTIs[jti]; ok {
+		return false, nil
+	}
+	s.revokedJTIs[jti] = expiresAt
+	return true, nil
+}
+
+func (s *memTokenStore) IsJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.revokedJTIs[jti]
+	return ok, nil
+}
+
+func (s *memTokenStore) PurgeExpired(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, expiresAt := range s.revokedJTIs {
+		if expiresAt.Before(now) {
+			delete(s.revokedJTIs, jti)
+		}
+	}
+	for id, t := range s.refreshTokens {
+		if t.ExpiresAt.Before(now) {
+			delete(s.refreshTokens, id)
+		}
+	}
+	for id, t := range s.emailTokens {
+		if t.ExpiresAt.Before(now) {
+			delete(s.emailTokens, id)
+		}
+	}
+	return nil
+}
+
+func (s *memTokenStore) CreateEmailToken(ctx context.Context, token *models.EmailToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.emailTokens {
+		if t.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	token.ID = s.newID()
+	saved := *token
+	s.emailTokens[token.ID] = &saved
+	return nil
+}
+
+func (s *memTokenStore) GetEmailToken(ctx context.Context, tokenHash string) (*models.EmailToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.emailTokens {
+		if t.TokenHash == tokenHash {
+			found := *t
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memTokenStore) UseEmailToken(ctx context.Context, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.emailTokens[id]
+	if !ok || t.Used {
+		return false, nil
+	}
+	t.Used = true
+	return true, nil
+}
+
+func (s *memTokenStore) InvalidateEmailTokens(ctx context.Context, username, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.emailTokens {
+		if t.Username == username && t.Purpose == purpose {
+			t.Used = true
+		}
+	}
+	return nil
+}
+
+func (s *memTokenStore) ReplaceRecoveryCodes(ctx context.Context, username string, codeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 与 code_hash 的唯一约束一致，冲突时不做任何修改
+	for _, hash := range codeHashes {
+		if code, ok := s.recoveryCodes[hash]; ok && code.username != username {
+			return ErrDuplicate
+		}
+	}
+	for hash, code := range s.recoveryCodes {
+		if code.username == username {
+			delete(s.recoveryCodes, hash)
+		}
+	}
+	for _, hash := range codeHashes {
+		s.recoveryCodes[hash] = &recoveryCode{username: username}
+	}
+	return nil
+}
+
+func (s *memTokenStore) UseRecoveryCode(ctx context.Context, username, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.recoveryCodes[codeHash]
+	if !ok || code.username != username || code.used {
+		return false, nil
+	}
+	code.used = true
+	return true, nil
+}
+
+func (s *memTokenStore) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, code := range s.recoveryCodes {
+		if code.username == username && !code.used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *memTokenStore) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, code := range s.recoveryCodes {
+		if code.username == username {
+			delete(s.recoveryCodes, hash)
+		}
+	}
+	return nil
+}
+
+type memRecordingStore struct{ *memoryDB }
+
+func (s *memRecordingStore) Create(ctx context.Context, rec *models.Recording) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec.ID = s.newID()
+	saved := *rec
+	s.recordings[rec.ID] = &saved
+	return nil
+}
+
+func (s *memRecordingStore) Finish(ctx context.Context, id, size int64, endedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.recordings[id]; ok {
+		rec.Size = size
+		rec.EndedAt = &endedAt
+	}
+	return nil
+}
+
+func (s *memRecordingStore) Get(ctx context.Context, id int64) (*models.Recording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.recordings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *rec
+	return &found, nil
+}
+
+func (s *memRecordingStore) ListByRoom(ctx context.Context, roomID int64) ([]models.Recording, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recordings := []models.Recording{}
+	for _, rec := range s.recordings {
+		if rec.RoomID == roomID {
+			recordings = append(recordings, *rec)
+		}
+	}
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].ID < recordings[j].ID })
+	return recordings, nil
+}
+
+func (s *memRecordingStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.recordings, id)
+	return nil
+}
+
+type memBanStore struct{ *memoryDB }
+
+func (s *memBanStore) Create(ctx context.Context, ban *models.RoomBan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban.ID = s.newID()
+	saved := *ban
+	s.bans[ban.ID] = &saved
+	return nil
+}
+
+func (s *memBanStore) IsBanned(ctx context.Context, roomID int64, visitorID, ip string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ban := range s.bans {
+		if ban.RoomID != roomID {
+			continue
+		}
+		if ban.VisitorID != "" && ban.VisitorID == visitorID || ban.IP != "" && ban.IP == ip {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memBanStore) ListByRoom(ctx context.Context, roomID int64) ([]models.RoomBan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bans := []models.RoomBan{}
+	for _, ban := range s.bans {
+		if ban.RoomID == roomID {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].ID < bans[j].ID })
+	return bans, nil
+}
+
+func (s *memBanStore) Delete(ctx context.Context, roomID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ban, ok := s.bans[id]
+	if !ok || ban.RoomID != roomID {
+		return ErrNotFound
+	}
+	delete(s.bans, id)
+	return nil
+}
+
+type memThrottleStore struct{ *memoryDB }
+
+func (s *memThrottleStore) RecordFailure(ctx context.Context, scope, key string, at, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := throttleKey{scope, key}
+	t, ok := s.throttles[k]
+	switch {
+	case !ok:
+		t = &models.LoginThrottle{Scope: scope, Key: key}
+		s.throttles[k] = t
+		t.Failures = 1
+	case t.LastFailure.Before(resetBefore) && (t.LockedUntil == nil || t.LockedUntil.Before(resetBefore)):
+		t.Failures = 1
+	default:
+		t.Failures++
+	}
+	t.LastFailure = at
+	return t.Failures, nil
+}
+
+func (s *memThrottleStore) Lock(ctx context.Context, scope, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.throttles[throttleKey{scope, key}]; ok {
+		t.LockedUntil = &until
+	}
+	return nil
+}
+
+func (s *memThrottleStore) Get(ctx context.Context, scope, key string) (*models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.throttles[throttleKey{scope, key}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *t
+	return &found, nil
+}
+
+func (s *memThrottleStore) List(ctx context.Context) ([]models.LoginThrottle, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := []models.LoginThrottle{}
+	for _, t := range s.throttles {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastFailure.After(list[j].LastFailure) })
+	return list, nil
+}
+
+func (s *memThrottleStore) Delete(ctx context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := throttleKey{scope, key}
+	if _, ok := s.throttles[k]; !ok {
+		return ErrNotFound
+	}
+	delete(s.throttles, k)
+	return nil
+}
+
+func (s *memThrottleStore) Purge(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, t := range s.throttles {
+		if t.LastFailure.Before(before) && (t.LockedUntil == nil || t.LockedUntil.Before(before)) {
+			delete(s.throttles, k)
+		}
+	}
+	return nil
+}
+
+type memJoinFailureStore struct{ *memoryDB }
+
+func (s *memJoinFailureStore) Create(ctx context.Context, f *models.JoinFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f.ID = s.newID()
+	s.joinFailures = append(s.joinFailures, *f)
+	return nil
+}
+
+func (s *memJoinFailureStore) CountByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	return s.count(ip, since, func(f *models.JoinFailure) string { return f.IP })
+}
+
+func (s *memJoinFailureStore) CountByVisitor(ctx context.Context, visitorID string, since time.Time) (int, time.Time, error) {
+	return s.count(visitorID, since, func(f *models.JoinFailure) string { return f.VisitorID })
+}
+
+func (s *memJoinFailureStore) count(value string, since time.Time, field func(*models.JoinFailure) string) (int, time.Time, error) {
+	var oldest time.Time
+	if value == "" {
+		return 0, oldest, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for i := range s.joinFailures {
+		f := &s.joinFailures[i]
+		if field(f) != value || f.CreatedAt.Before(since) {
+			continue
+		}
+		if count == 0 || f.CreatedAt.Before(oldest) {
+			oldest = f.CreatedAt
+		}
+		count++
+	}
+	return count, oldest, nil
+}
+
+func (s *memJoinFailureStore) List(ctx context.Context, limit int) ([]models.JoinFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 按写入顺序保存，ID 递增
+	list := []models.JoinFailure{}
+	for i := len(s.joinFailures) - 1; i >= 0 && len(list) < limit; i-- {
+		list = append(list, s.joinFailures[i])
+	}
+	return list, nil
+}
+
+func (s *memJoinFailureStore) Purge(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.joinFailures[:0]
+	for _, f := range s.joinFailures {
+		if !f.CreatedAt.Before(before) {
+			kept = append(kept, f)
+		}
+	}
+	s.joinFailures = kept
+	return nil
+}
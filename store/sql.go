@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"talkFlow/migrations"
+)
+
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// 基于 database/sql 的实现，SQL 统一使用 ? 占位符，执行前按方言转换
+type sqlDB struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// 将 ? 占位符转换为 PostgreSQL 的 $1, $2 ...
+func (d *sqlDB) rebind(query string) string {
+	if d.dialect != dialectPostgres {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func (d *sqlDB) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.db.ExecContext(ctx, d.rebind(query), args...)
+}
+
+func (d *sqlDB) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, d.rebind(query), args...)
+}
+
+func (d *sqlDB) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return d.db.QueryRowContext(ctx, d.rebind(query), args...)
+}
+
+// 执行 INSERT 并返回自增ID；PostgreSQL 不支持 LastInsertId，改用 RETURNING
+func (d *sqlDB) insert(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	if d.dialect == dialectPostgres {
+		var id int64
+		err := d.queryRow(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	result, err := d.exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// 唯一约束冲突
+func (d *sqlDB) isDuplicate(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") || // SQLite
+		strings.Contains(msg, "SQLSTATE 23505") // PostgreSQL unique_violation
+}
+
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+func newSQLStore(db *sql.DB, d dialect) (*Store, error) {
+	base := &sqlDB{db: db, dialect: d}
+	migrationDialect := migrations.SQLite
+	if d == dialectPostgres {
+		migrationDialect = migrations.Postgres
+	}
+	migrator, err := migrations.New(db, migrationDialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		Users:        &sqlUserStore{base},
+		Rooms:        &sqlRoomStore{base},
+		Visitors:     &sqlVisitorStore{base},
+		Logs:         &sqlLogStore{base},
+		Tokens:       &sqlTokenStore{base},
+		Recordings:   &sqlRecordingStore{base},
+		Bans:         &sqlBanStore{base},
+		Throttles:    &sqlThrottleStore{base},
+		JoinFailures: &sqlJoinFailureStore{base},
+		Migrations:   migrator,
+		close:        db.Close,
+	}, nil
+}
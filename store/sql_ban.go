@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+
+	"talkFlow/models"
+)
+
+type sqlBanStore struct{ *sqlDB }
+
+func (s *sqlBanStore) Create(ctx context.Context, ban *models.RoomBan) error {
+	insertSQL := `
+        INSERT INTO room_bans (room_id, visitor_id, ip, reason, banned_by, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL, ban.RoomID, ban.VisitorID, ban.IP, ban.Reason, ban.BannedBy, ban.CreatedAt)
+	if err != nil {
+		return err
+	}
+	ban.ID = id
+	return nil
+}
+
+func (s *sqlBanStore) IsBanned(ctx context.Context, roomID int64, visitorID, ip string) (bool, error) {
+	var count int
+	querySQL := `
+        SELECT COUNT(*) FROM room_bans
+        WHERE room_id = ? AND ((visitor_id <> '' AND visitor_id = ?) OR (ip <> '' AND ip = ?))`
+	if err := s.queryRow(ctx, querySQL, roomID, visitorID, ip).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *sqlBanStore) ListByRoom(ctx context.Context, roomID int64) ([]models.RoomBan, error) {
+	querySQL := `
+        SELECT id, room_id, visitor_id, ip, reason, banned_by, created_at
+        FROM room_bans WHERE room_id = ? ORDER BY id`
+	rows, err := s.query(ctx, querySQL, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bans := []models.RoomBan{}
+	for rows.Next() {
+		var ban models.RoomBan
+		if err := rows.Scan(&ban.ID, &ban.RoomID, &ban.VisitorID, &ban.IP, &ban.Reason, &ban.BannedBy, &ban.CreatedAt); err != nil {
+			return nil, err
+		}
+		bans = append(bans, ban)
+	}
+	return bans, rows.Err()
+}
+
+func (s *sqlBanStore) Delete(ctx context.Context, roomID, id int64) error {
+	result, err := s.exec(ctx, `DELETE FROM room_bans WHERE id = ? AND room_id = ?`, id, roomID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
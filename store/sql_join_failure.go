@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlJoinFailureStore struct{ *sqlDB }
+
+func (s *sqlJoinFailureStore) Create(ctx context.Context, f *models.JoinFailure) error {
+	insertSQL := `
+        INSERT INTO join_failures (join_code, visitor_id, ip, source, created_at)
+        VALUES (?, ?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL, f.JoinCode, f.VisitorID, f.IP, f.Source, f.CreatedAt)
+	if err != nil {
+		return err
+	}
+	f.ID = id
+	return nil
+}
+
+func (s *sqlJoinFailureStore) CountByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error) {
+	return s.count(ctx, "ip", ip, since)
+}
+
+func (s *sqlJoinFailureStore) CountByVisitor(ctx context.Context, visitorID string, since time.Time) (int, time.Time, error) {
+	return s.count(ctx, "visitor_id", visitorID, since)
+}
+
+// column 只会是固定的列名
+func (s *sqlJoinFailureStore) count(ctx context.Context, column, value string, since time.Time) (int, time.Time, error) {
+	var count int
+	var oldest time.Time
+	if value == "" {
+		return 0, oldest, nil
+	}
+	where := ` FROM join_failures WHERE ` + column + ` = ? AND created_at >= ?`
+	if err := s.queryRow(ctx, `SELECT COUNT(*)`+where, value, since).Scan(&count); err != nil {
+		return 0, oldest, err
+	}
+	if count == 0 {
+		return 0, oldest, nil
+	}
+	// 聚合函数在 SQLite 中返回字符串，单独查询最早一条以得到 time.Time
+	err := s.queryRow(ctx, `SELECT created_at`+where+` ORDER BY created_at LIMIT 1`, value, since).Scan(&oldest)
+	return count, oldest, err
+}
+
+func (s *sqlJoinFailureStore) List(ctx context.Context, limit int) ([]models.JoinFailure, error) {
+	querySQL := `
+        SELECT id, join_code, visitor_id, ip, source, created_at
+        FROM join_failures ORDER BY id DESC LIMIT ?`
+	rows, err := s.query(ctx, querySQL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.JoinFailure{}
+	for rows.Next() {
+		var f models.JoinFailure
+		if err := rows.Scan(&f.ID, &f.JoinCode, &f.VisitorID, &f.IP, &f.Source, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlJoinFailureStore) Purge(ctx context.Context, before time.Time) error {
+	_, err := s.exec(ctx, `DELETE FROM join_failures WHERE created_at < ?`, before)
+	return err
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlRecordingStore struct{ *sqlDB }
+
+const recordingColumns = `id, room_id, participant, format, file_path, size, started_by, started_at, ended_at`
+
+func scanRecording(row scanner) (*models.Recording, error) {
+	var rec models.Recording
+	err := row.Scan(&rec.ID, &rec.RoomID, &rec.Participant, &rec.Format, &rec.FilePath,
+		&rec.Size, &rec.StartedBy, &rec.StartedAt, &rec.EndedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &rec, nil
+}
+
+func (s *sqlRecordingStore) Create(ctx context.Context, rec *models.Recording) error {
+	insertSQL := `
+        INSERT INTO recordings (room_id, participant, format, file_path, size, started_by, started_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL,
+		rec.RoomID, rec.Participant, rec.Format, rec.FilePath, rec.Size, rec.StartedBy, rec.StartedAt,
+	)
+	if err != nil {
+		return err
+	}
+	rec.ID = id
+	return nil
+}
+
+func (s *sqlRecordingStore) Finish(ctx context.Context, id, size int64, endedAt time.Time) error {
+	_, err := s.exec(ctx, `UPDATE recordings SET size = ?, ended_at = ? WHERE id = ?`, size, endedAt, id)
+	return err
+}
+
+func (s *sqlRecordingStore) Get(ctx context.Context, id int64) (*models.Recording, error) {
+	return scanRecording(s.queryRow(ctx, `SELECT `+recordingColumns+` FROM recordings WHERE id = ?`, id))
+}
+
+func (s *sqlRecordingStore) ListByRoom(ctx context.Context, roomID int64) ([]models.Recording, error) {
+	rows, err := s.query(ctx, `SELECT `+recordingColumns+` FROM recordings WHERE room_id = ? ORDER BY id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordings := []models.Recording{}
+	for rows.Next() {
+		rec, err := scanRecording(rows)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, *rec)
+	}
+	return recordings, rows.Err()
+}
+
+func (s *sqlRecordingStore) Delete(ctx context.Context, id int64) error {
+	_, err := s.exec(ctx, `DELETE FROM recordings WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlRoomStore struct{ *sqlDB }
+
+const roomColumns = `id, creater, name, joiner, join_code, create_time, expire_time, status, ip, media_mode, locked`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRoom(row scanner) (*models.Room, error) {
+	var room models.Room
+	err := row.Scan(
+		&room.ID,
+		&room.Creater,
+		&room.Name,
+		&room.JoinerStr, // 先用字符串接收
+		&room.JoinCode,
+		&room.CreateTime,
+		&room.ExpireTime,
+		&room.Status,
+		&room.IP,
+		&room.MediaMode,
+		&room.Locked,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	// 反序列化 joiner 字段
+	room.Joiner = strings.Split(room.JoinerStr, ",")
+	return &room, nil
+}
+
+func (s *sqlRoomStore) Create(ctx context.Context, room *models.Room) error {
+	insertSQL := `
+        INSERT INTO rooms (creater, name, joiner, join_code, create_time, expire_time, status, ip, media_mode, locked)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	// 将 joiner 字段（string slice）序列化为字符串存储到数据库
+	room.JoinerStr = strings.Join(room.Joiner, ",")
+
+	id, err := s.insert(ctx, insertSQL,
+		room.Creater, room.Name, room.JoinerStr, room.JoinCode,
+		room.CreateTime, room.ExpireTime, room.Status, room.IP, room.MediaMode, room.Locked,
+	)
+	if s.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	room.ID = id
+	return nil
+}
+
+func (s *sqlRoomStore) GetByID(ctx context.Context, id int64) (*models.Room, error) {
+	return scanRoom(s.queryRow(ctx, `SELECT `+roomColumns+` FROM rooms WHERE id = ?`, id))
+}
+
+// 加入码在房间结束后可以被新房间使用，优先返回进行中的房间，其次是最近创建的
+func (s *sqlRoomStore) GetByJoinCode(ctx context.Context, joinCode string) (*models.Room, error) {
+	querySQL := `
+        SELECT ` + roomColumns + ` FROM rooms WHERE join_code = ?
+        ORDER BY CASE WHEN status = ? THEN 0 ELSE 1 END, id DESC LIMIT 1`
+	return scanRoom(s.queryRow(ctx, querySQL, joinCode, models.RoomOngoing))
+}
+
+func (s *sqlRoomStore) EndExpired(ctx context.Context, joinCode string, now time.Time) (bool, error) {
+	result, err := s.exec(ctx, `
+        UPDATE rooms SET status = ?
+        WHERE join_code = ? AND status = ? AND expire_time < ?`, models.RoomEnded, joinCode, models.RoomOngoing, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlRoomStore) UpdateStatus(ctx context.Context, id int64, status models.RoomStatus) error {
+	_, err := s.exec(ctx, `UPDATE rooms SET status = ? WHERE id = ?`, status, id)
+	return err
+}
+
+func (s *sqlRoomStore) UpdateExpireTime(ctx context.Context, id int64, expireTime time.Time) error {
+	_, err := s.exec(ctx, `UPDATE rooms SET expire_time = ? WHERE id = ?`, expireTime, id)
+	return err
+}
+
+func (s *sqlRoomStore) SetLocked(ctx context.Context, id int64, locked bool) error {
+	_, err := s.exec(ctx, `UPDATE rooms SET locked = ? WHERE id = ?`, locked, id)
+	return err
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlThrottleStore struct{ *sqlDB }
+
+const throttleColumns = `scope, key, failures, last_failure, locked_until`
+
+func scanThrottle(row scanner) (*models.LoginThrottle, error) {
+	var t models.LoginThrottle
+	if err := row.Scan(&t.Scope, &t.Key, &t.Failures, &t.LastFailure, &t.LockedUntil); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *sqlThrottleStore) RecordFailure(ctx context.Context, scope, key string, at, resetBefore time.Time) (int, error) {
+	// 并发失败由数据库累加，多个实例共享同一份计数
+	upsertSQL := `
+        INSERT INTO login_throttles (scope, key, failures, last_failure)
+        VALUES (?, ?, 1, ?)
+        ON CONFLICT (scope, key) DO UPDATE SET
+            failures = CASE
+                WHEN login_throttles.last_failure < ?
+                    AND (login_throttles.locked_until IS NULL OR login_throttles.locked_until < ?)
+                THEN 1
+                ELSE login_throttles.failures + 1
+            END,
+            last_failure = excluded.last_failure`
+	if _, err := s.exec(ctx, upsertSQL, scope, key, at, resetBefore, resetBefore); err != nil {
+		return 0, err
+	}
+
+	var failures int
+	err := s.queryRow(ctx, `SELECT failures FROM login_throttles WHERE scope = ? AND key = ?`, scope, key).Scan(&failures)
+	return failures, err
+}
+
+func (s *sqlThrottleStore) Lock(ctx context.Context, scope, key string, until time.Time) error {
+	_, err := s.exec(ctx, `UPDATE login_throttles SET locked_until = ? WHERE scope = ? AND key = ?`, until, scope, key)
+	return err
+}
+
+func (s *sqlThrottleStore) Get(ctx context.Context, scope, key string) (*models.LoginThrottle, error) {
+	row := s.queryRow(ctx, `SELECT `+throttleColumns+` FROM login_throttles WHERE scope = ? AND key = ?`, scope, key)
+	t, err := scanThrottle(row)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return t, nil
+}
+
+func (s *sqlThrottleStore) List(ctx context.Context) ([]models.LoginThrottle, error) {
+	rows, err := s.query(ctx, `SELECT `+throttleColumns+` FROM login_throttles ORDER BY last_failure DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.LoginThrottle{}
+	for rows.Next() {
+		t, err := scanThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlThrottleStore) Delete(ctx context.Context, scope, key string) error {
+	result, err := s.exec(ctx, `DELETE FROM login_throttles WHERE scope = ? AND key = ?`, scope, key)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlThrottleStore) Purge(ctx context.Context, before time.Time) error {
+	_, err := s.exec(ctx, `
+        DELETE FROM login_throttles
+        WHERE last_failure < ? AND (locked_until IS NULL OR locked_until < ?)`, before, before)
+	return err
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlTokenStore struct{ *sqlDB }
+
+func (s *sqlTokenStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	insertSQL := `
+        INSERT INTO refresh_tokens (username, token_hash, family, expires_at, revoked, created_at, ip)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL,
+		token.Username, token.TokenHash, token.Family, token.ExpiresAt, token.Revoked, token.CreatedAt, token.IP,
+	)
+	if s.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	return nil
+}
+
+func (s *sqlTokenStore) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var t models.RefreshToken
+	querySQL := `
+        SELECT id, username, token_hash, family, expires_at, revoked, created_at, ip
+        FROM refresh_tokens WHERE token_hash = ?`
+	err := s.queryRow(ctx, querySQL, tokenHash).Scan(
+		&t.ID, &t.Username, &t.TokenHash, &t.Family, &t.ExpiresAt, &t.Revoked, &t.CreatedAt, &t.IP,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &t, nil
+}
+
+func (s *sqlTokenStore) RevokeRefreshToken(ctx context.Context, id int64) (bool, error) {
+	// 以 revoked = false 作为条件，保证并发刷新时只有一个请求能成功
+	result, err := s.exec(ctx, `UPDATE refresh_tokens SET revoked = ? WHERE id = ? AND revoked = ?`, true, id, false)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *sqlTokenStore) RevokeRefreshFamily(ctx context.Context, family string) error {
+	_, err := s.exec(ctx, `UPDATE refresh_tokens SET revoked = ? WHERE family = ?`, true, family)
+	return err
+}
+
+func (s *sqlTokenStore) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	_, err := s.exec(ctx, `UPDATE refresh_tokens SET revoked = ? WHERE username = ?`, true, username)
+	return err
+}
+
+func (s *sqlTokenStore) RevokeJTI(ctx context.Context, jti, username string, expiresAt time.Time) error {
+	insertSQL := `
+        INSERT INTO revoked_tokens (jti, username, expires_at, revoked_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (jti) DO NOTHING`
+	_, err := s.exec(ctx, insertSQL, jti, username, expiresAt, time.Now())
+	return err
+}
+
+func (s *sqlTokenStore) ConsumeJTI(ctx context.Context, jti, username string, expiresAt time.Time) (bool, error) {
+	// 以插入是否生效判断，保证并发使用同一个令牌时只有一个请求能成功
+	insertSQL := `
+        INSERT INTO revoked_tokens (jti, username, expires_at, revoked_at)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (jti) DO NOTHING`
+	result, err := s.exec(ctx, insertSQL, jti, username, expiresAt, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (s *sqlTokenStore) IsJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	var count int
+	err := s.queryRow(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`, jti).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *sqlTokenStore) PurgeExpired(ctx context.Context, now time.Time) error {
+	if _, err := s.exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	if _, err := s.exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < ?`, now); err != nil {
+		return err
+	}
+	_, err := s.exec(ctx, `DELETE FROM email_tokens WHERE expires_at < ?`, now)
+	return err
+}
+
+func (s *sqlTokenStore) CreateEmailToken(ctx context.Context, token *models.EmailToken) error {
+	insertSQL := `
+        INSERT INTO email_tokens (username, email, purpose, token_hash, expires_at, used, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL,
+		token.Username, token.Email, token.Purpose, token.TokenHash, token.ExpiresAt, token.Used, token.CreatedAt,
+	)
+	if s.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	return nil
+}
+
+func (s *sqlTokenStore) GetEmailToken(ctx context.Context, tokenHash string) (*models.EmailToken, error) {
+	var t models.EmailToken
+	querySQL := `
+        SELECT id, username, email, purpose, token_hash, expires_at, used, created_at
+        FROM email_tokens WHERE token_hash = ?`
+	err := s.queryRow(ctx, querySQL, tokenHash).Scan(
+		&t.ID, &t.Username, &t.Email, &t.Purpose, &t.TokenHash, &t.ExpiresAt, &t.Used, &t.CreatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &t, nil
+}
+
+func (s *sqlTokenStore) UseEmailToken(ctx context.Context, id int64) (bool, error) {
+	// 以 used = false 作为条件，保证同一令牌只能成功使用一次
+	result, err := s.exec(ctx, `UPDATE email_tokens SET used = ? WHERE id = ? AND used = ?`, true, id, false)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (s *sqlTokenStore) InvalidateEmailTokens(ctx context.Context, username, purpose string) error {
+	_, err := s.exec(ctx, `UPDATE email_tokens SET used = ? WHERE username = ? AND purpose = ? AND used = ?`,
+		true, username, purpose, false)
+	return err
+}
+
+func (s *sqlTokenStore) ReplaceRecoveryCodes(ctx context.Context, username string, codeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM mfa_recovery_codes WHERE username = ?`), username); err != nil {
+		return err
+	}
+	insertSQL := s.rebind(`
+        INSERT INTO mfa_recovery_codes (username, code_hash, used, created_at)
+        VALUES (?, ?, ?, ?)`)
+	now := time.Now()
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, insertSQL, username, hash, false, now); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlTokenStore) UseRecoveryCode(ctx context.Context, username, codeHash string) (bool, error) {
+	result, err := s.exec(ctx, `
+        UPDATE mfa_recovery_codes SET used = ?
+        WHERE username = ? AND code_hash = ? AND used = ?`, true, username, codeHash, false)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlTokenStore) CountRecoveryCodes(ctx context.Context, username string) (int, error) {
+	var count int
+	err := s.queryRow(ctx, `SELECT COUNT(*) FROM mfa_recovery_codes WHERE username = ? AND used = ?`, username, false).Scan(&count)
+	return count, err
+}
+
+func (s *sqlTokenStore) DeleteRecoveryCodes(ctx context.Context, username string) error {
+	_, err := s.exec(ctx, `DELETE FROM mfa_recovery_codes WHERE username = ?`, username)
+	return err
+}
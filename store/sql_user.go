@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/models"
+)
+
+type sqlUserStore struct{ *sqlDB }
+
+func (s *sqlUserStore) Create(ctx context.Context, user *models.Register) error {
+	insertSQL := `
+        INSERT INTO register (username, password, email, avatar, created_at, register_ip, is_register, role, email_verified)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	id, err := s.insert(ctx, insertSQL,
+		user.Username, user.Password, user.Email, user.Avatar,
+		user.CreatedAt, user.RegisterIP, user.IsRegister, user.Role, user.EmailVerified,
+	)
+	if s.isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+const userColumns = `id, username, password, email, avatar, created_at, register_ip, is_register, role, email_verified, mfa_secret, mfa_enabled, mfa_last_step, last_login_ip, last_login_time, tokens_valid_after`
+
+func scanUser(row scanner) (*models.Register, error) {
+	var user models.Register
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Password,
+		&user.Email,
+		&user.Avatar,
+		&user.CreatedAt,
+		&user.RegisterIP,
+		&user.IsRegister,
+		&user.Role,
+		&user.EmailVerified,
+		&user.MFASecret,
+		&user.MFAEnabled,
+		&user.MFALastStep,
+		&user.LastLoginIP,
+		&user.LastLoginTime,
+		&user.TokensValidAfter,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *sqlUserStore) GetByUsername(ctx context.Context, username string) (*models.Register, error) {
+	return scanUser(s.queryRow(ctx, `SELECT `+userColumns+` FROM register WHERE username = ?`, username))
+}
+
+func (s *sqlUserStore) UpdateLastLogin(ctx context.Context, id int64, ip string, at time.Time) error {
+	_, err := s.exec(ctx, `UPDATE register SET last_login_ip = ?, last_login_time = ? WHERE id = ?`, ip, at, id)
+	return err
+}
+
+func (s *sqlUserStore) List(ctx context.Context) ([]models.Register, error) {
+	return s.list(ctx, `SELECT `+userColumns+` FROM register ORDER BY id`)
+}
+
+func (s *sqlUserStore) ListByEmail(ctx context.Context, email string) ([]models.Register, error) {
+	return s.list(ctx, `SELECT `+userColumns+` FROM register WHERE LOWER(email) = LOWER(?) ORDER BY id`, email)
+}
+
+func (s *sqlUserStore) list(ctx context.Context, querySQL string, args ...interface{}) ([]models.Register, error) {
+	rows, err := s.query(ctx, querySQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.Register{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlUserStore) SetRole(ctx context.Context, username string, role models.Role) error {
+	return s.updateUser(ctx, `UPDATE register SET role = ? WHERE username = ?`, role, username)
+}
+
+func (s *sqlUserStore) SetEmailVerified(ctx context.Context, username string, verified bool) error {
+	return s.updateUser(ctx, `UPDATE register SET email_verified = ? WHERE username = ?`, verified, username)
+}
+
+func (s *sqlUserStore) UpdatePassword(ctx context.Context, username, passwordHash string, at time.Time) error {
+	return s.updateUser(ctx, `UPDATE register SET password = ?, tokens_valid_after = ? WHERE username = ?`, passwordHash, at, username)
+}
+
+func (s *sqlUserStore) SetMFA(ctx context.Context, username, secret string, enabled bool) error {
+	// 更换密钥时清除已使用的时间步；开启时密钥不变，确认用过的验证码不能再用于登录
+	updateSQL := `
+        UPDATE register SET
+            mfa_last_step = CASE WHEN mfa_secret = ? THEN mfa_last_step ELSE 0 END,
+            mfa_secret = ?, mfa_enabled = ?
+        WHERE username = ?`
+	return s.updateUser(ctx, updateSQL, secret, secret, enabled, username)
+}
+
+func (s *sqlUserStore) UseMFAStep(ctx context.Context, username string, step int64) (bool, error) {
+	// 条件更新保证同一个验证码在并发请求中也只能使用一次
+	result, err := s.exec(ctx, `UPDATE register SET mfa_last_step = ? WHERE username = ? AND mfa_last_step < ?`, step, username, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// 执行只影响一个用户的更新，用户不存在时返回 ErrNotFound
+func (s *sqlUserStore) updateUser(ctx context.Context, updateSQL string, args ...interface{}) error {
+	result, err := s.exec(ctx, updateSQL, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlUserStore) CountByRole(ctx context.Context, role models.Role) (int, error) {
+	var count int
+	err := s.queryRow(ctx, `SELECT COUNT(*) FROM register WHERE role = ?`, role).Scan(&count)
+	return count, err
+}
+
+type sqlVisitorStore struct{ *sqlDB }
+
+func (s *sqlVisitorStore) Create(ctx context.Context, visitor *models.Visitor) error {
+	insertSQL := `
+        INSERT INTO visitor (visitor_id, created_at, visitor_ip, is_register)
+        VALUES (?, ?, ?, ?)`
+	id, err := s.insert(ctx, insertSQL, visitor.VisitorID, visitor.CreatedAt, visitor.VisitorIP, visitor.IsRegister)
+	if err != nil {
+		return err
+	}
+	visitor.ID = id
+	return nil
+}
+
+type sqlLogStore struct{ *sqlDB }
+
+func (s *sqlLogStore) Insert(ctx context.Context, entry *models.LogEntry) (int64, error) {
+	insertSQL := `
+        INSERT INTO log (username, error, timestamp, ip)
+        VALUES (?, ?, ?, ?)`
+	return s.insert(ctx, insertSQL, entry.Username, entry.Error, entry.Timestamp, entry.IP)
+}
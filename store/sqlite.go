@@ -0,0 +1,42 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// 打开 SQLite 数据库，目录不存在时自动创建
+func OpenSQLite(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// 对连接池进行配置
+	db.SetMaxOpenConns(1)                  // SQLite 不支持并发写，多连接可能导致锁冲突，所以一般设置为1
+	db.SetMaxIdleConns(1)                  // 同上
+	db.SetConnMaxLifetime(0 * time.Second) // 永不过期
+
+	// Ping 一下数据库，确保连接可用
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s, err := newSQLStore(db, dialectSQLite)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
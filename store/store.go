@@ -0,0 +1,160 @@
+// Package store 定义数据访问接口，业务代码只依赖这些接口而不直接拼写 SQL。
+//
+// 目前提供基于 database/sql 的实现，支持 SQLite 和 PostgreSQL 两种后端（见 OpenSQLite / OpenPostgres），
+// 测试中可以替换为内存实现。
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"talkFlow/migrations"
+	"talkFlow/models"
+)
+
+var (
+	ErrNotFound  = errors.New("store: not found")
+	ErrDuplicate = errors.New("store: duplicate")
+)
+
+type UserStore interface {
+	// 用户名已存在时返回 ErrDuplicate
+	Create(ctx context.Context, user *models.Register) error
+	GetByUsername(ctx context.Context, username string) (*models.Register, error)
+	UpdateLastLogin(ctx context.Context, id int64, ip string, at time.Time) error
+	List(ctx context.Context) ([]models.Register, error)
+	// 用户不存在时返回 ErrNotFound
+	SetRole(ctx context.Context, username string, role models.Role) error
+	CountByRole(ctx context.Context, role models.Role) (int, error)
+	// 同一邮箱可能注册了多个账号
+	ListByEmail(ctx context.Context, email string) ([]models.Register, error)
+	// 用户不存在时返回 ErrNotFound
+	SetEmailVerified(ctx context.Context, username string, verified bool) error
+	// 用户不存在时返回 ErrNotFound
+	// 同时将 tokens_valid_after 设为 at，之前签发的访问令牌随之失效
+	UpdatePassword(ctx context.Context, username, passwordHash string, at time.Time) error
+	// 设置两步验证密钥和开启状态，用户不存在时返回 ErrNotFound
+	SetMFA(ctx context.Context, username, secret string, enabled bool) error
+	// 记录使用了时间步 step 的验证码，step 不大于上次使用的时间步时返回 false
+	UseMFAStep(ctx context.Context, username string, step int64) (bool, error)
+}
+
+type RoomStore interface {
+	// 加入码已被进行中的房间使用时返回 ErrDuplicate
+	Create(ctx context.Context, room *models.Room) error
+	GetByID(ctx context.Context, id int64) (*models.Room, error)
+	// 同一加入码有多个房间时返回进行中的那个，没有则返回最近创建的
+	GetByJoinCode(ctx context.Context, joinCode string) (*models.Room, error)
+	// 将使用该加入码、已过期但仍标记为进行中的房间标记为已结束，有房间被更新时返回 true
+	EndExpired(ctx context.Context, joinCode string, now time.Time) (bool, error)
+	UpdateStatus(ctx context.Context, id int64, status models.RoomStatus) error
+	UpdateExpireTime(ctx context.Context, id int64, expireTime time.Time) error
+	SetLocked(ctx context.Context, id int64, locked bool) error
+}
+
+type VisitorStore interface {
+	Create(ctx context.Context, visitor *models.Visitor) error
+}
+
+type LogStore interface {
+	// 返回日志ID，便于在错误响应中提示
+	Insert(ctx context.Context, entry *models.LogEntry) (int64, error)
+}
+
+// 刷新令牌和访问令牌黑名单
+type TokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// 将未吊销的令牌标记为已吊销，令牌已被吊销时返回 false
+	RevokeRefreshToken(ctx context.Context, id int64) (bool, error)
+	RevokeRefreshFamily(ctx context.Context, family string) error
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+	RevokeJTI(ctx context.Context, jti, username string, expiresAt time.Time) error
+	IsJTIRevoked(ctx context.Context, jti string) (bool, error)
+	// 将 jti 加入黑名单，已在黑名单中时返回 false；用于只能使用一次的令牌，并发调用时只有一个返回 true
+	ConsumeJTI(ctx context.Context, jti, username string, expiresAt time.Time) (bool, error)
+	// 删除已过期的黑名单、刷新令牌和邮件令牌
+	PurgeExpired(ctx context.Context, now time.Time) error
+
+	CreateEmailToken(ctx context.Context, token *models.EmailToken) error
+	GetEmailToken(ctx context.Context, tokenHash string) (*models.EmailToken, error)
+	// 将未使用的令牌标记为已使用，令牌已被使用时返回 false
+	UseEmailToken(ctx context.Context, id int64) (bool, error)
+	// 作废用户某种用途的所有未使用令牌，重新发送邮件时调用
+	InvalidateEmailTokens(ctx context.Context, username, purpose string) error
+
+	// 用新的一组恢复码替换用户原有的恢复码
+	ReplaceRecoveryCodes(ctx context.Context, username string, codeHashes []string) error
+	// 将用户未使用的恢复码标记为已使用，恢复码不存在或已使用时返回 false
+	UseRecoveryCode(ctx context.Context, username, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, username string) (int, error)
+	DeleteRecoveryCodes(ctx context.Context, username string) error
+}
+
+type RecordingStore interface {
+	Create(ctx context.Context, rec *models.Recording) error
+	Finish(ctx context.Context, id, size int64, endedAt time.Time) error
+	Get(ctx context.Context, id int64) (*models.Recording, error)
+	ListByRoom(ctx context.Context, roomID int64) ([]models.Recording, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// 房间封禁
+type BanStore interface {
+	Create(ctx context.Context, ban *models.RoomBan) error
+	// 访客ID或IP任一命中即视为被封禁，空字符串不参与匹配
+	IsBanned(ctx context.Context, roomID int64, visitorID, ip string) (bool, error)
+	ListByRoom(ctx context.Context, roomID int64) ([]models.RoomBan, error)
+	// 封禁记录不属于该房间时返回 ErrNotFound
+	Delete(ctx context.Context, roomID, id int64) error
+}
+
+// 登录失败和重置密码申请计数，scope 为 models 中的 Throttle* 常量
+type ThrottleStore interface {
+	// 记录一次失败并返回累计失败次数；最后一次失败和锁定结束都早于 resetBefore 时重新计数
+	RecordFailure(ctx context.Context, scope, key string, at, resetBefore time.Time) (int, error)
+	Lock(ctx context.Context, scope, key string, until time.Time) error
+	Get(ctx context.Context, scope, key string) (*models.LoginThrottle, error)
+	List(ctx context.Context) ([]models.LoginThrottle, error)
+	// 记录不存在时返回 ErrNotFound
+	Delete(ctx context.Context, scope, key string) error
+	// 删除最后一次失败和锁定结束都早于 before 的记录
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// 加入码校验失败记录
+type JoinFailureStore interface {
+	Create(ctx context.Context, f *models.JoinFailure) error
+	// since 之后该IP的失败次数，以及其中最早一次的时间；ip 为空时返回 0
+	CountByIP(ctx context.Context, ip string, since time.Time) (int, time.Time, error)
+	// 同 CountByIP，按访客ID统计
+	CountByVisitor(ctx context.Context, visitorID string, since time.Time) (int, time.Time, error)
+	// 最近的 limit 条记录，新的在前
+	List(ctx context.Context, limit int) ([]models.JoinFailure, error)
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// 所有数据访问接口的集合
+type Store struct {
+	Users        UserStore
+	Rooms        RoomStore
+	Visitors     VisitorStore
+	Logs         LogStore
+	Tokens       TokenStore
+	Recordings   RecordingStore
+	Bans         BanStore
+	Throttles    ThrottleStore
+	JoinFailures JoinFailureStore
+
+	Migrations *migrations.Migrator // 表结构迁移，内存实现为 nil
+
+	close func() error
+}
+
+func (s *Store) Close() error {
+	if s.close == nil {
+		return nil
+	}
+	return s.close()
+}
@@ -0,0 +1,592 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"talkFlow/models"
+)
+
+// 同一组用例分别在内存实现和 SQLite 上运行，保证两者行为一致
+func forEachStore(t *testing.T, fn func(t *testing.T, s *Store)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemory())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		s, err := OpenSQLite(filepath.Join(t.TempDir(), "talkflow.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		if _, err := s.Migrations.Up(context.Background()); err != nil {
+			t.Fatalf("迁移失败: %v", err)
+		}
+		fn(t, s)
+	})
+}
+
+// 数据库中的时间只保证到秒以下的精度，统一截断后比较
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Millisecond).Equal(b.Truncate(time.Millisecond))
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		alice := &models.Register{Username: "alice", Password: "h1", Email: "Alice@example.com", CreatedAt: now}
+		must(t, s.Users.Create(ctx, alice))
+		if alice.ID == 0 || alice.Role != models.RoleMember {
+			t.Fatalf("Create 没有回填ID或默认角色: %+v", alice)
+		}
+		if err := s.Users.Create(ctx, &models.Register{Username: "alice", CreatedAt: now}); err != ErrDuplicate {
+			t.Fatalf("重复用户名返回 %v，期望 ErrDuplicate", err)
+		}
+		must(t, s.Users.Create(ctx, &models.Register{Username: "bob", Email: "alice@EXAMPLE.com", Role: models.RoleHost, CreatedAt: now}))
+
+		if _, err := s.Users.GetByUsername(ctx, "nobody"); err != ErrNotFound {
+			t.Fatalf("GetByUsername 不存在的用户返回 %v", err)
+		}
+		got, err := s.Users.GetByUsername(ctx, "alice")
+		must(t, err)
+		if got.ID != alice.ID || got.Email != alice.Email || !sameTime(got.CreatedAt, now) {
+			t.Fatalf("GetByUsername = %+v", got)
+		}
+
+		// 邮箱不区分大小写，按ID排序
+		byEmail, err := s.Users.ListByEmail(ctx, "ALICE@example.com")
+		must(t, err)
+		if len(byEmail) != 2 || byEmail[0].Username != "alice" || byEmail[1].Username != "bob" {
+			t.Fatalf("ListByEmail = %+v", byEmail)
+		}
+		all, err := s.Users.List(ctx)
+		must(t, err)
+		if len(all) != 2 {
+			t.Fatalf("List 返回 %d 个用户", len(all))
+		}
+
+		must(t, s.Users.SetRole(ctx, "alice", models.RoleAdmin))
+		must(t, s.Users.SetEmailVerified(ctx, "alice", true))
+		reset := now.Add(30 * time.Second)
+		must(t, s.Users.UpdatePassword(ctx, "alice", "h2", reset))
+		for name, err := range map[string]error{
+			"SetRole":          s.Users.SetRole(ctx, "nobody", models.RoleAdmin),
+			"SetEmailVerified": s.Users.SetEmailVerified(ctx, "nobody", true),
+			"UpdatePassword":   s.Users.UpdatePassword(ctx, "nobody", "x", now),
+			"SetMFA":           s.Users.SetMFA(ctx, "nobody", "S", true),
+		} {
+			if err != ErrNotFound {
+				t.Errorf("%s 不存在的用户返回 %v", name, err)
+			}
+		}
+		count, err := s.Users.CountByRole(ctx, models.RoleAdmin)
+		must(t, err)
+		if count != 1 {
+			t.Fatalf("CountByRole = %d", count)
+		}
+
+		login := now.Add(time.Minute)
+		must(t, s.Users.UpdateLastLogin(ctx, alice.ID, "10.0.0.1", login))
+		got, err = s.Users.GetByUsername(ctx, "alice")
+		must(t, err)
+		if got.Role != models.RoleAdmin || !got.EmailVerified || got.Password != "h2" ||
+			got.LastLoginIP.String != "10.0.0.1" || !sameTime(got.LastLoginTime.Time, login) ||
+			!got.TokensValidAfter.Valid || !sameTime(got.TokensValidAfter.Time, reset) {
+			t.Fatalf("更新后 = %+v", got)
+		}
+	})
+}
+
+func TestUserStoreMFA(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		must(t, s.Users.Create(ctx, &models.Register{Username: "alice", CreatedAt: time.Now()}))
+
+		must(t, s.Users.SetMFA(ctx, "alice", "SECRET1", false))
+		if ok, err := s.Users.UseMFAStep(ctx, "alice", 100); err != nil || !ok {
+			t.Fatalf("UseMFAStep(100) = %v, %v", ok, err)
+		}
+		// 同一时间步和更早的时间步不能再用
+		for _, step := range []int64{100, 99} {
+			if ok, _ := s.Users.UseMFAStep(ctx, "alice", step); ok {
+				t.Fatalf("UseMFAStep(%d) 重放成功", step)
+			}
+		}
+		// 开启时密钥不变，已用过的时间步仍然无效
+		must(t, s.Users.SetMFA(ctx, "alice", "SECRET1", true))
+		if ok, _ := s.Users.UseMFAStep(ctx, "alice", 100); ok {
+			t.Fatal("开启后重放成功")
+		}
+		// 更换密钥后重新计数
+		must(t, s.Users.SetMFA(ctx, "alice", "SECRET2", true))
+		if ok, _ := s.Users.UseMFAStep(ctx, "alice", 50); !ok {
+			t.Fatal("更换密钥后时间步没有重置")
+		}
+		got, err := s.Users.GetByUsername(ctx, "alice")
+		must(t, err)
+		if got.MFASecret != "SECRET2" || !got.MFAEnabled || got.MFALastStep != 50 {
+			t.Fatalf("MFA 状态 = %q %v %d", got.MFASecret, got.MFAEnabled, got.MFALastStep)
+		}
+		if ok, err := s.Users.UseMFAStep(ctx, "nobody", 1); ok || err != nil {
+			t.Fatalf("UseMFAStep 不存在的用户 = %v, %v", ok, err)
+		}
+	})
+}
+
+func newRoom(code string, status models.RoomStatus, expire time.Time) *models.Room {
+	return &models.Room{
+		Creater:    "alice",
+		Name:       "room",
+		Joiner:     []string{"alice", "bob"},
+		JoinCode:   code,
+		CreateTime: time.Now(),
+		ExpireTime: expire,
+		Status:     status,
+		MediaMode:  models.MediaMesh,
+	}
+}
+
+func TestRoomStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		ended := newRoom("ABC123", models.RoomEnded, now.Add(-time.Hour))
+		must(t, s.Rooms.Create(ctx, ended))
+		ongoing := newRoom("ABC123", models.RoomOngoing, now.Add(time.Hour))
+		must(t, s.Rooms.Create(ctx, ongoing))
+		// 进行中的房间加入码唯一，已结束的不受限制
+		if err := s.Rooms.Create(ctx, newRoom("ABC123", models.RoomOngoing, now.Add(time.Hour))); err != ErrDuplicate {
+			t.Fatalf("重复加入码返回 %v，期望 ErrDuplicate", err)
+		}
+		newer := newRoom("ABC123", models.RoomEnded, now.Add(-time.Minute))
+		must(t, s.Rooms.Create(ctx, newer))
+
+		got, err := s.Rooms.GetByJoinCode(ctx, "ABC123")
+		must(t, err)
+		if got.ID != ongoing.ID {
+			t.Fatalf("GetByJoinCode 返回 %d，期望进行中的 %d", got.ID, ongoing.ID)
+		}
+		if len(got.Joiner) != 2 || got.Joiner[1] != "bob" || !sameTime(got.ExpireTime, ongoing.ExpireTime) {
+			t.Fatalf("GetByJoinCode = %+v", got)
+		}
+		if _, err := s.Rooms.GetByJoinCode(ctx, "NOPE"); err != ErrNotFound {
+			t.Fatalf("GetByJoinCode 不存在的加入码返回 %v", err)
+		}
+		if _, err := s.Rooms.GetByID(ctx, 999999); err != ErrNotFound {
+			t.Fatalf("GetByID 不存在的房间返回 %v", err)
+		}
+
+		// 没有进行中的房间时返回最近创建的
+		must(t, s.Rooms.UpdateStatus(ctx, ongoing.ID, models.RoomEnded))
+		got, err = s.Rooms.GetByJoinCode(ctx, "ABC123")
+		must(t, err)
+		if got.ID != newer.ID {
+			t.Fatalf("GetByJoinCode 返回 %d，期望最近创建的 %d", got.ID, newer.ID)
+		}
+
+		extended := now.Add(2 * time.Hour)
+		must(t, s.Rooms.UpdateExpireTime(ctx, ongoing.ID, extended))
+		must(t, s.Rooms.SetLocked(ctx, ongoing.ID, true))
+		got, err = s.Rooms.GetByID(ctx, ongoing.ID)
+		must(t, err)
+		if got.Status != models.RoomEnded || !got.Locked || !sameTime(got.ExpireTime, extended) {
+			t.Fatalf("更新后 = %+v", got)
+		}
+	})
+}
+
+func TestRoomStoreEndExpired(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		expired := newRoom("OLD001", models.RoomOngoing, now.Add(-time.Minute))
+		must(t, s.Rooms.Create(ctx, expired))
+		live := newRoom("NEW001", models.RoomOngoing, now.Add(time.Hour))
+		must(t, s.Rooms.Create(ctx, live))
+
+		if ok, err := s.Rooms.EndExpired(ctx, "NEW001", now); err != nil || ok {
+			t.Fatalf("EndExpired 未过期的房间 = %v, %v", ok, err)
+		}
+		if ok, err := s.Rooms.EndExpired(ctx, "OLD001", now); err != nil || !ok {
+			t.Fatalf("EndExpired = %v, %v", ok, err)
+		}
+		if ok, _ := s.Rooms.EndExpired(ctx, "OLD001", now); ok {
+			t.Fatal("EndExpired 重复结束")
+		}
+		// 过期房间结束后加入码可以重新使用
+		must(t, s.Rooms.Create(ctx, newRoom("OLD001", models.RoomOngoing, now.Add(time.Hour))))
+	})
+}
+
+func TestVisitorAndLogStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		v := &models.Visitor{VisitorID: "v1", CreatedAt: time.Now(), VisitorIP: "10.0.0.1"}
+		must(t, s.Visitors.Create(ctx, v))
+		if v.ID == 0 {
+			t.Fatal("Visitors.Create 没有回填ID")
+		}
+		id1, err := s.Logs.Insert(ctx, &models.LogEntry{Username: "alice", Error: "e1"})
+		must(t, err)
+		id2, err := s.Logs.Insert(ctx, &models.LogEntry{Username: "alice", Error: "e2"})
+		must(t, err)
+		if id1 == 0 || id2 <= id1 {
+			t.Fatalf("日志ID = %d, %d", id1, id2)
+		}
+	})
+}
+
+func TestTokenStoreRefresh(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		t1 := &models.RefreshToken{Username: "alice", TokenHash: "h1", Family: "f1", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+		must(t, s.Tokens.CreateRefreshToken(ctx, t1))
+		if err := s.Tokens.CreateRefreshToken(ctx, &models.RefreshToken{Username: "alice", TokenHash: "h1", Family: "f1", ExpiresAt: now, CreatedAt: now}); err != ErrDuplicate {
+			t.Fatalf("重复哈希返回 %v", err)
+		}
+		t2 := &models.RefreshToken{Username: "alice", TokenHash: "h2", Family: "f2", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+		must(t, s.Tokens.CreateRefreshToken(ctx, t2))
+		t3 := &models.RefreshToken{Username: "bob", TokenHash: "h3", Family: "f3", ExpiresAt: now.Add(-time.Minute), CreatedAt: now}
+		must(t, s.Tokens.CreateRefreshToken(ctx, t3))
+
+		// 只能吊销一次，并发刷新时只有一个成功
+		if ok, err := s.Tokens.RevokeRefreshToken(ctx, t1.ID); err != nil || !ok {
+			t.Fatalf("RevokeRefreshToken = %v, %v", ok, err)
+		}
+		if ok, _ := s.Tokens.RevokeRefreshToken(ctx, t1.ID); ok {
+			t.Fatal("RevokeRefreshToken 重复吊销成功")
+		}
+		must(t, s.Tokens.RevokeRefreshFamily(ctx, "f2"))
+		got, err := s.Tokens.GetRefreshToken(ctx, "h2")
+		must(t, err)
+		if !got.Revoked || got.Username != "alice" || !sameTime(got.ExpiresAt, t2.ExpiresAt) {
+			t.Fatalf("GetRefreshToken = %+v", got)
+		}
+		must(t, s.Tokens.RevokeUserRefreshTokens(ctx, "bob"))
+		if got, _ := s.Tokens.GetRefreshToken(ctx, "h3"); !got.Revoked {
+			t.Fatal("RevokeUserRefreshTokens 没有生效")
+		}
+
+		must(t, s.Tokens.RevokeJTI(ctx, "j1", "alice", now.Add(time.Hour)))
+		must(t, s.Tokens.RevokeJTI(ctx, "j1", "alice", now.Add(time.Hour))) // 重复吊销不报错
+		must(t, s.Tokens.RevokeJTI(ctx, "j2", "alice", now.Add(-time.Minute)))
+		if ok, _ := s.Tokens.IsJTIRevoked(ctx, "j1"); !ok {
+			t.Fatal("IsJTIRevoked(j1) = false")
+		}
+
+		// 只能使用一次的令牌：并发使用时只有一个成功
+		var consumed atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := s.Tokens.ConsumeJTI(ctx, "once", "", now.Add(time.Hour))
+				if err != nil {
+					t.Errorf("ConsumeJTI: %v", err)
+				}
+				if ok {
+					consumed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := consumed.Load(); n != 1 {
+			t.Fatalf("并发 ConsumeJTI 成功 %d 次，期望 1", n)
+		}
+		if ok, _ := s.Tokens.ConsumeJTI(ctx, "j1", "", now.Add(time.Hour)); ok {
+			t.Fatal("已吊销的 jti 不能再次使用")
+		}
+
+		// 清理过期的黑名单和刷新令牌
+		must(t, s.Tokens.PurgeExpired(ctx, now))
+		if ok, _ := s.Tokens.IsJTIRevoked(ctx, "j2"); ok {
+			t.Fatal("过期的 jti 没有被清理")
+		}
+		if ok, _ := s.Tokens.IsJTIRevoked(ctx, "j1"); !ok {
+			t.Fatal("未过期的 jti 被清理")
+		}
+		if _, err := s.Tokens.GetRefreshToken(ctx, "h3"); err != ErrNotFound {
+			t.Fatalf("过期的刷新令牌没有被清理: %v", err)
+		}
+	})
+}
+
+func TestTokenStoreEmail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		newToken := func(hash, purpose string, expires time.Time) *models.EmailToken {
+			return &models.EmailToken{Username: "alice", Email: "a@example.com", Purpose: purpose, TokenHash: hash, ExpiresAt: expires, CreatedAt: now}
+		}
+		verify := newToken("e1", models.EmailTokenVerify, now.Add(time.Hour))
+		must(t, s.Tokens.CreateEmailToken(ctx, verify))
+		if err := s.Tokens.CreateEmailToken(ctx, newToken("e1", models.EmailTokenVerify, now)); err != ErrDuplicate {
+			t.Fatalf("重复哈希返回 %v", err)
+		}
+		reset := newToken("e2", models.EmailTokenReset, now.Add(time.Hour))
+		must(t, s.Tokens.CreateEmailToken(ctx, reset))
+		must(t, s.Tokens.CreateEmailToken(ctx, newToken("e3", models.EmailTokenVerify, now.Add(-time.Minute))))
+
+		if ok, err := s.Tokens.UseEmailToken(ctx, verify.ID); err != nil || !ok {
+			t.Fatalf("UseEmailToken = %v, %v", ok, err)
+		}
+		if ok, _ := s.Tokens.UseEmailToken(ctx, verify.ID); ok {
+			t.Fatal("UseEmailToken 重复使用成功")
+		}
+
+		// 只作废指定用途的令牌
+		must(t, s.Tokens.InvalidateEmailTokens(ctx, "alice", models.EmailTokenVerify))
+		got, err := s.Tokens.GetEmailToken(ctx, "e2")
+		must(t, err)
+		if got.Used || got.Purpose != models.EmailTokenReset || got.Email != "a@example.com" {
+			t.Fatalf("GetEmailToken = %+v", got)
+		}
+		if got, _ := s.Tokens.GetEmailToken(ctx, "e3"); !got.Used {
+			t.Fatal("InvalidateEmailTokens 没有生效")
+		}
+
+		must(t, s.Tokens.PurgeExpired(ctx, now))
+		if _, err := s.Tokens.GetEmailToken(ctx, "e3"); err != ErrNotFound {
+			t.Fatalf("过期的邮件令牌没有被清理: %v", err)
+		}
+		if _, err := s.Tokens.GetEmailToken(ctx, "nope"); err != ErrNotFound {
+			t.Fatalf("GetEmailToken 不存在的令牌返回 %v", err)
+		}
+	})
+}
+
+func TestTokenStoreRecoveryCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+
+		must(t, s.Tokens.ReplaceRecoveryCodes(ctx, "alice", []string{"r1", "r2", "r3"}))
+		must(t, s.Tokens.ReplaceRecoveryCodes(ctx, "bob", []string{"b1"}))
+		if ok, err := s.Tokens.UseRecoveryCode(ctx, "alice", "r1"); err != nil || !ok {
+			t.Fatalf("UseRecoveryCode = %v, %v", ok, err)
+		}
+		if ok, _ := s.Tokens.UseRecoveryCode(ctx, "alice", "r1"); ok {
+			t.Fatal("恢复码重复使用成功")
+		}
+		if ok, _ := s.Tokens.UseRecoveryCode(ctx, "alice", "b1"); ok {
+			t.Fatal("使用了其他用户的恢复码")
+		}
+		if n, _ := s.Tokens.CountRecoveryCodes(ctx, "alice"); n != 2 {
+			t.Fatalf("CountRecoveryCodes = %d，期望 2", n)
+		}
+
+		// 重新生成后旧的恢复码全部失效
+		must(t, s.Tokens.ReplaceRecoveryCodes(ctx, "alice", []string{"r4", "r5"}))
+		if ok, _ := s.Tokens.UseRecoveryCode(ctx, "alice", "r2"); ok {
+			t.Fatal("替换后旧恢复码仍然有效")
+		}
+		if n, _ := s.Tokens.CountRecoveryCodes(ctx, "alice"); n != 2 {
+			t.Fatalf("CountRecoveryCodes = %d，期望 2", n)
+		}
+		must(t, s.Tokens.DeleteRecoveryCodes(ctx, "alice"))
+		if n, _ := s.Tokens.CountRecoveryCodes(ctx, "alice"); n != 0 {
+			t.Fatalf("删除后 CountRecoveryCodes = %d", n)
+		}
+		if n, _ := s.Tokens.CountRecoveryCodes(ctx, "bob"); n != 1 {
+			t.Fatalf("其他用户的恢复码被删除: %d", n)
+		}
+	})
+}
+
+func TestRecordingStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		r1 := &models.Recording{RoomID: 1, Participant: "v1", Format: models.RecordingOgg, FilePath: "/tmp/a.ogg", StartedBy: "alice", StartedAt: now}
+		must(t, s.Recordings.Create(ctx, r1))
+		must(t, s.Recordings.Create(ctx, &models.Recording{RoomID: 1, Participant: "v2", Format: models.RecordingWebM, StartedAt: now}))
+		must(t, s.Recordings.Create(ctx, &models.Recording{RoomID: 2, Participant: "v3", Format: models.RecordingWebM, StartedAt: now}))
+
+		got, err := s.Recordings.Get(ctx, r1.ID)
+		must(t, err)
+		if !got.IsActive() || got.FilePath != "/tmp/a.ogg" {
+			t.Fatalf("Get = %+v", got)
+		}
+		ended := now.Add(time.Minute)
+		must(t, s.Recordings.Finish(ctx, r1.ID, 1234, ended))
+		got, err = s.Recordings.Get(ctx, r1.ID)
+		must(t, err)
+		if got.IsActive() || got.Size != 1234 || !sameTime(*got.EndedAt, ended) {
+			t.Fatalf("Finish 后 = %+v", got)
+		}
+
+		list, err := s.Recordings.ListByRoom(ctx, 1)
+		must(t, err)
+		if len(list) != 2 || list[0].ID != r1.ID {
+			t.Fatalf("ListByRoom = %+v", list)
+		}
+		must(t, s.Recordings.Delete(ctx, r1.ID))
+		if _, err := s.Recordings.Get(ctx, r1.ID); err != ErrNotFound {
+			t.Fatalf("删除后 Get 返回 %v", err)
+		}
+	})
+}
+
+func TestBanStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		byVisitor := &models.RoomBan{RoomID: 1, VisitorID: "v1", BannedBy: "alice", CreatedAt: now}
+		must(t, s.Bans.Create(ctx, byVisitor))
+		must(t, s.Bans.Create(ctx, &models.RoomBan{RoomID: 1, IP: "10.0.0.9", BannedBy: "alice", CreatedAt: now}))
+
+		cases := []struct {
+			room      int64
+			visitor   string
+			ip        string
+			wantBan   bool
+			situation string
+		}{
+			{1, "v1", "10.0.0.1", true, "访客ID命中"},
+			{1, "v2", "10.0.0.9", true, "IP命中"},
+			{1, "v2", "10.0.0.1", false, "都不命中"},
+			{1, "", "", false, "空字符串不参与匹配"},
+			{2, "v1", "10.0.0.9", false, "其他房间"},
+		}
+		for _, c := range cases {
+			banned, err := s.Bans.IsBanned(ctx, c.room, c.visitor, c.ip)
+			must(t, err)
+			if banned != c.wantBan {
+				t.Errorf("%s: IsBanned = %v", c.situation, banned)
+			}
+		}
+
+		list, err := s.Bans.ListByRoom(ctx, 1)
+		must(t, err)
+		if len(list) != 2 || list[0].ID != byVisitor.ID {
+			t.Fatalf("ListByRoom = %+v", list)
+		}
+		if err := s.Bans.Delete(ctx, 2, byVisitor.ID); err != ErrNotFound {
+			t.Fatalf("删除其他房间的封禁返回 %v", err)
+		}
+		must(t, s.Bans.Delete(ctx, 1, byVisitor.ID))
+		if banned, _ := s.Bans.IsBanned(ctx, 1, "v1", ""); banned {
+			t.Fatal("解除封禁后仍然被封禁")
+		}
+	})
+}
+
+func TestThrottleStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+		window := 15 * time.Minute
+
+		for i := 1; i <= 3; i++ {
+			n, err := s.Throttles.RecordFailure(ctx, models.ThrottleUser, "alice", now, now.Add(-window))
+			must(t, err)
+			if n != i {
+				t.Fatalf("第 %d 次失败计数为 %d", i, n)
+			}
+		}
+		must(t, s.Throttles.Lock(ctx, models.ThrottleUser, "alice", now.Add(time.Minute)))
+		got, err := s.Throttles.Get(ctx, models.ThrottleUser, "alice")
+		must(t, err)
+		if got.Failures != 3 || got.LockedUntil == nil || !sameTime(*got.LockedUntil, now.Add(time.Minute)) {
+			t.Fatalf("Get = %+v", got)
+		}
+
+		// 超过窗口且不在锁定中时重新计数
+		later := now.Add(window + time.Hour)
+		n, err := s.Throttles.RecordFailure(ctx, models.ThrottleUser, "alice", later, later.Add(-window))
+		must(t, err)
+		if n != 1 {
+			t.Fatalf("窗口过后计数为 %d，期望 1", n)
+		}
+		// 锁定结束晚于窗口起点时继续累加
+		must(t, s.Throttles.Lock(ctx, models.ThrottleUser, "alice", later.Add(time.Hour)))
+		muchLater := later.Add(window + time.Minute)
+		n, err = s.Throttles.RecordFailure(ctx, models.ThrottleUser, "alice", muchLater, muchLater.Add(-window))
+		must(t, err)
+		if n != 2 {
+			t.Fatalf("锁定期间计数为 %d，期望 2", n)
+		}
+
+		_, err = s.Throttles.RecordFailure(ctx, models.ThrottleIP, "10.0.0.1", now, now.Add(-window))
+		must(t, err)
+		list, err := s.Throttles.List(ctx)
+		must(t, err)
+		if len(list) != 2 || list[0].Key != "alice" {
+			t.Fatalf("List 应按最后失败时间倒序: %+v", list)
+		}
+
+		// 清理只删除已过期且不在锁定中的记录
+		must(t, s.Throttles.Purge(ctx, now.Add(time.Second)))
+		if _, err := s.Throttles.Get(ctx, models.ThrottleIP, "10.0.0.1"); err != ErrNotFound {
+			t.Fatalf("过期记录没有被清理: %v", err)
+		}
+		must(t, s.Throttles.Delete(ctx, models.ThrottleUser, "alice"))
+		if err := s.Throttles.Delete(ctx, models.ThrottleUser, "alice"); err != ErrNotFound {
+			t.Fatalf("重复删除返回 %v", err)
+		}
+	})
+}
+
+func TestJoinFailureStore(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *Store) {
+		ctx := context.Background()
+		now := time.Now()
+
+		add := func(ip, visitor string, at time.Time) {
+			t.Helper()
+			must(t, s.JoinFailures.Create(ctx, &models.JoinFailure{
+				JoinCode: "ZZZZZZ", IP: ip, VisitorID: visitor, Source: models.JoinSourceJoin, CreatedAt: at,
+			}))
+		}
+		add("10.0.0.1", "v1", now.Add(-time.Hour))
+		add("10.0.0.1", "v1", now.Add(-2*time.Minute))
+		add("10.0.0.1", "v2", now.Add(-time.Minute))
+		add("10.0.0.2", "", now)
+
+		count, oldest, err := s.JoinFailures.CountByIP(ctx, "10.0.0.1", now.Add(-10*time.Minute))
+		must(t, err)
+		if count != 2 || !sameTime(oldest, now.Add(-2*time.Minute)) {
+			t.Fatalf("CountByIP = %d, %v", count, oldest)
+		}
+		count, _, err = s.JoinFailures.CountByVisitor(ctx, "v1", now.Add(-2*time.Hour))
+		must(t, err)
+		if count != 2 {
+			t.Fatalf("CountByVisitor = %d", count)
+		}
+		if count, _, _ := s.JoinFailures.CountByVisitor(ctx, "", now.Add(-2*time.Hour)); count != 0 {
+			t.Fatalf("空访客ID的计数为 %d", count)
+		}
+
+		list, err := s.JoinFailures.List(ctx, 2)
+		must(t, err)
+		if len(list) != 2 || list[0].IP != "10.0.0.2" || list[0].ID <= list[1].ID {
+			t.Fatalf("List 应按ID倒序: %+v", list)
+		}
+
+		must(t, s.JoinFailures.Purge(ctx, now.Add(-30*time.Minute)))
+		count, _, err = s.JoinFailures.CountByIP(ctx, "10.0.0.1", now.Add(-2*time.Hour))
+		must(t, err)
+		if count != 2 {
+			t.Fatalf("Purge 后 CountByIP = %d，期望 2", count)
+		}
+	})
+}
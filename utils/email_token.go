@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+)
+
+var (
+	ErrEmailTokenInvalid = errors.New("email token invalid")
+	ErrEmailTokenExpired = errors.New("email token expired")
+)
+
+// 签发邮箱验证或重置密码令牌，同一用户同一用途之前的令牌随即作废
+func IssueEmailToken(ctx context.Context, username, email, purpose string) (string, error) {
+	ttl := config.EmailVerifyTTL
+	if purpose == models.EmailTokenReset {
+		ttl = config.PasswordResetTTL
+	}
+
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Store.Tokens.InvalidateEmailTokens(ctx, username, purpose); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = config.Store.Tokens.CreateEmailToken(ctx, &models.EmailToken{
+		Username:  username,
+		Email:     email,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// 使用令牌，令牌只能成功使用一次
+func ConsumeEmailToken(ctx context.Context, token, purpose string) (*models.EmailToken, error) {
+	et, err := config.Store.Tokens.GetEmailToken(ctx, hashToken(token))
+	if err == store.ErrNotFound || (err == nil && (et.Purpose != purpose || et.Used)) {
+		return nil, ErrEmailTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(et.ExpiresAt) {
+		return nil, ErrEmailTokenExpired
+	}
+
+	ok, err := config.Store.Tokens.UseEmailToken(ctx, et.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrEmailTokenInvalid
+	}
+	return et, nil
+}
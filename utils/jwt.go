@@ -1,24 +1,111 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"talkFlow/config"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateToken(username string) (string, error) {
+// 令牌类型，写在 typ 字段中，防止不同用途的令牌混用
+const (
+	TokenTypeAccess = "access"
+	TokenTypeRoom   = "room"
+	TokenTypeMFA    = "mfa"
+)
+
+var ErrInvalidTicket = errors.New("invalid room ticket")
+
+// 房间入场凭证，绑定房间ID和访客ID
+type RoomClaims struct {
+	Type      string `json:"typ"`
+	RoomID    int64  `json:"room_id"`
+	VisitorID string `json:"visitor_id"`
+	Name      string `json:"name,omitempty"` // 房间内显示的昵称
+	Host      bool   `json:"host,omitempty"` // 持有者是房主，可以执行管理操作
+	jwt.RegisteredClaims
+}
+
+// 生成访问令牌，同时返回 jti 和过期时间，便于登出时加入黑名单
+func GenerateToken(username string) (string, string, time.Time, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	exp := time.Now().Add(config.AccessTokenTTL)
+
 	claims := jwt.MapClaims{
 		"username": username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(), // 3天过期
+		"typ":      TokenTypeAccess,
+		"jti":      jti,
+		"iat":      time.Now().Unix(),
+		"exp":      exp.Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(config.JWTSecret)
+	signed, err := token.SignedString(config.JWTSecret)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	return signed, jti, exp, nil
 }
 
 func ParseToken(tokenStr string) (*jwt.Token, error) {
 	return jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		return config.JWTSecret, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
+// 生成房间入场凭证，有效期不会超过房间本身的过期时间
+func GenerateRoomTicket(roomID int64, visitorID, name string, host bool, roomExpire time.Time) (string, time.Time, error) {
+	exp := time.Now().Add(config.RoomTicketTTL)
+	if roomExpire.Before(exp) {
+		exp = roomExpire
+	}
+
+	claims := RoomClaims{
+		Type:      TokenTypeRoom,
+		RoomID:    roomID,
+		VisitorID: visitorID,
+		Name:      name,
+		Host:      host,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(config.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, exp, nil
+}
+
+// 解析并校验房间入场凭证
+func ParseRoomTicket(ticket string) (*RoomClaims, error) {
+	claims := &RoomClaims{}
+	token, err := jwt.ParseWithClaims(ticket, claims, func(token *jwt.Token) (interface{}, error) {
+		return config.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidTicket
+	}
+	if claims.Type != TokenTypeRoom || claims.RoomID == 0 || claims.VisitorID == "" {
+		return nil, ErrInvalidTicket
+	}
+	return claims, nil
+}
+
+// 生成 n 字节的随机串（十六进制编码）
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+)
+
+// 登录限流：用户名和IP分别统计连续失败次数，达到上限后锁定，之后每次失败锁定时长翻倍。
+// 计数保存在数据库中，多个实例共享；锁定期间的请求直接拒绝，不再比对密码，也不计入失败次数。
+
+// 用户名或IP还需要等待多久才能再次尝试登录，未锁定时返回 0
+func LoginRetryAfter(ctx context.Context, username, ip string) (time.Duration, error) {
+	return retryAfter(ctx, loginThrottleKeys(username, ip))
+}
+
+// 记录一次登录失败，达到上限时锁定并返回锁定时长，否则返回 0
+func RecordLoginFailure(ctx context.Context, username, ip string) (time.Duration, error) {
+	return recordThrottled(ctx, loginThrottleKeys(username, ip))
+}
+
+// 登录成功后清除用户名的失败记录；IP的记录保留到自然过期，避免用自己的账号重置计数
+func ClearLoginFailures(ctx context.Context, username string) error {
+	err := config.Store.Throttles.Delete(ctx, models.ThrottleUser, username)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+type throttleKey struct {
+	scope, key string
+	limit      int
+}
+
+// 各维度中最长的剩余锁定时长
+func retryAfter(ctx context.Context, keys []throttleKey) (time.Duration, error) {
+	var wait time.Duration
+	for _, t := range keys {
+		entry, err := config.Store.Throttles.Get(ctx, t.scope, t.key)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if entry.LockedUntil != nil {
+			wait = max(wait, time.Until(*entry.LockedUntil))
+		}
+	}
+	return wait, nil
+}
+
+// 每个维度计数加一，达到上限的维度锁定，返回最长的锁定时长
+func recordThrottled(ctx context.Context, keys []throttleKey) (time.Duration, error) {
+	now := time.Now()
+	var locked time.Duration
+	for _, t := range keys {
+		failures, err := config.Store.Throttles.RecordFailure(ctx, t.scope, t.key, now, now.Add(-config.LoginFailureWindow))
+		if err != nil {
+			return 0, err
+		}
+		d := lockoutDuration(failures, t.limit)
+		if d == 0 {
+			continue
+		}
+		if err := config.Store.Throttles.Lock(ctx, t.scope, t.key, now.Add(d)); err != nil {
+			return 0, err
+		}
+		locked = max(locked, d)
+	}
+	return locked, nil
+}
+
+// 需要统计的维度，上限为 0 的维度不统计
+func loginThrottleKeys(username, ip string) []throttleKey {
+	var keys []throttleKey
+	if config.LoginMaxFailures > 0 && username != "" {
+		keys = append(keys, throttleKey{models.ThrottleUser, username, config.LoginMaxFailures})
+	}
+	if config.LoginIPMaxFailures > 0 && ip != "" {
+		keys = append(keys, throttleKey{models.ThrottleIP, ip, config.LoginIPMaxFailures})
+	}
+	return keys
+}
+
+// 第 limit 次失败锁定 LoginLockout，此后每多失败一次翻倍，不超过 LoginLockoutMax
+func lockoutDuration(failures, limit int) time.Duration {
+	if failures < limit {
+		return 0
+	}
+	d := config.LoginLockout
+	for i := limit; i < failures && d < config.LoginLockoutMax; i++ {
+		d *= 2
+	}
+	return min(d, config.LoginLockoutMax)
+}
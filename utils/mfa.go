@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"image/png"
+	"strings"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var ErrInvalidMFAToken = errors.New("invalid mfa token")
+
+const (
+	totpPeriod        = 30 // 验证码有效秒数，与常见的身份验证器 App 一致
+	totpSkew          = 1  // 允许前后各偏差一个周期，容忍客户端时钟误差
+	recoveryCodeCount = 10
+	recoveryCodeLen   = 16 // 恢复码字符数（base32，80 比特），显示时每 4 个字符用 - 分隔
+)
+
+var totpOpts = totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+
+// 为用户生成新的 TOTP 密钥
+func NewTOTPKey(username string) (*otp.Key, error) {
+	return totp.Generate(totp.GenerateOpts{
+		Issuer:      config.MFAIssuer,
+		AccountName: username,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+}
+
+// 将 otpauth:// 链接编码为二维码 PNG，返回 data URL
+func TOTPQRCode(key *otp.Key) (string, error) {
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// 校验用户的 TOTP 验证码，同一个验证码（时间步）只能使用一次
+func ValidateTOTP(ctx context.Context, user *models.Register, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if user.MFASecret == "" || len(code) != otp.DigitsSix.Length() {
+		return false, nil
+	}
+
+	now := time.Now()
+	for i := -totpSkew; i <= totpSkew; i++ {
+		t := now.Add(time.Duration(i*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(user.MFASecret, t, totpOpts)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return config.Store.Users.UseMFAStep(ctx, user.Username, t.Unix()/totpPeriod)
+		}
+	}
+	return false, nil
+}
+
+// 生成一组新的恢复码并替换原有的恢复码，明文只返回这一次
+func NewRecoveryCodes(ctx context.Context, username string) ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeLen)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		for j, v := range b {
+			if j > 0 && j%4 == 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(alphabet[v%32])
+		}
+		codes[i] = sb.String()
+		hashes[i] = hashToken(normalizeRecoveryCode(codes[i]))
+	}
+	if err := config.Store.Tokens.ReplaceRecoveryCodes(ctx, username, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 使用一个恢复码，成功后该恢复码作废
+func UseRecoveryCode(ctx context.Context, username, code string) (bool, error) {
+	code = normalizeRecoveryCode(code)
+	if len(code) != recoveryCodeLen {
+		return false, nil
+	}
+	return config.Store.Tokens.UseRecoveryCode(ctx, username, hashToken(code))
+}
+
+// 忽略大小写、空格和分隔符
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// 两步验证令牌：密码校验通过后签发，只能用于提交验证码
+type MFAClaims struct {
+	Type     string `json:"typ"`
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+func GenerateMFAToken(username string) (string, time.Time, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	exp := time.Now().Add(config.MFATokenTTL)
+
+	claims := MFAClaims{
+		Type:     TokenTypeMFA,
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(config.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, exp, nil
+}
+
+func ParseMFAToken(token string) (*MFAClaims, error) {
+	claims := &MFAClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return config.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid || claims.Type != TokenTypeMFA || claims.Username == "" || claims.ID == "" {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+	"time"
+
+	"talkFlow/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TokenTypeChallenge = "challenge"
+	challengeTTL       = 5 * time.Minute // 工作量证明题目的有效期
+)
+
+var (
+	ErrChallengeInvalid = errors.New("challenge invalid")
+	ErrChallengeUsed    = errors.New("challenge already used")
+)
+
+// 工作量证明题目，绑定请求方IP，只能使用一次
+type ChallengeClaims struct {
+	Type       string `json:"typ"`
+	IP         string `json:"ip"`
+	Difficulty int    `json:"difficulty"`
+	jwt.RegisteredClaims
+}
+
+// 生成工作量证明题目：客户端需要找到 solution，使 SHA-256(challenge + ":" + solution) 至少有 difficulty 个前导零比特
+func IssueChallenge(ip string, difficulty int) (string, time.Time, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	exp := time.Now().Add(challengeTTL)
+
+	claims := ChallengeClaims{
+		Type:       TokenTypeChallenge,
+		IP:         ip,
+		Difficulty: difficulty,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(config.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, exp, nil
+}
+
+// 校验工作量证明，通过后题目作废
+func VerifyChallenge(ctx context.Context, challenge, solution, ip string) error {
+	claims := &ChallengeClaims{}
+	token, err := jwt.ParseWithClaims(challenge, claims, func(token *jwt.Token) (interface{}, error) {
+		return config.JWTSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.Type != TokenTypeChallenge || claims.ID == "" || claims.IP != ip {
+		return ErrChallengeInvalid
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) < claims.Difficulty {
+		return ErrChallengeInvalid
+	}
+
+	// 与访问令牌共用黑名单，记录保留到题目过期为止；并发提交同一个解时只有一个能通过
+	ok, err := ConsumeJTI(ctx, claims.ID, "", claims.ExpiresAt.Time)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrChallengeUsed
+	}
+	return nil
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
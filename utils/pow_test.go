@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"talkFlow/config"
+	"talkFlow/store"
+)
+
+// 找到满足难度的解
+func solveChallenge(t *testing.T, challenge string, difficulty int) string {
+	t.Helper()
+	for i := 0; i < 1<<20; i++ {
+		solution := strconv.Itoa(i)
+		if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) >= difficulty {
+			return solution
+		}
+	}
+	t.Fatal("没有找到解")
+	return ""
+}
+
+// 同一个解并发提交时只有一次能通过
+func TestVerifyChallengeOnce(t *testing.T) {
+	oldStore, oldSecret := config.Store, config.JWTSecret
+	config.Store, config.JWTSecret = store.NewMemory(), []byte("test-secret")
+	t.Cleanup(func() { config.Store, config.JWTSecret = oldStore, oldSecret })
+
+	const ip = "203.0.113.7"
+	challenge, _, err := IssueChallenge(ip, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := solveChallenge(t, challenge, 8)
+
+	if err := VerifyChallenge(context.Background(), challenge, solution, "203.0.113.8"); err != ErrChallengeInvalid {
+		t.Fatalf("其他IP提交返回 %v，期望 ErrChallengeInvalid", err)
+	}
+
+	var passed, used atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := VerifyChallenge(context.Background(), challenge, solution, ip); err {
+			case nil:
+				passed.Add(1)
+			case ErrChallengeUsed:
+				used.Add(1)
+			default:
+				t.Errorf("VerifyChallenge: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if passed.Load() != 1 || used.Load() != 19 {
+		t.Fatalf("通过 %d 次、已使用 %d 次，期望 1 和 19", passed.Load(), used.Load())
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"talkFlow/config"
+	"talkFlow/models"
+)
+
+// 重置密码邮件限流：邮箱和IP分别统计请求次数，与登录限流共用计数表、锁定时长和计数窗口。
+// 不论邮箱是否注册都计数，避免通过是否被限流判断邮箱是否存在。
+
+// 邮箱或IP还需要等待多久才能再次申请重置密码，未锁定时返回 0
+func PasswordResetRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	return retryAfter(ctx, resetThrottleKeys(email, ip))
+}
+
+// 记录一次重置密码申请，达到上限时锁定并返回锁定时长，否则返回 0
+func RecordPasswordResetRequest(ctx context.Context, email, ip string) (time.Duration, error) {
+	return recordThrottled(ctx, resetThrottleKeys(email, ip))
+}
+
+func resetThrottleKeys(email, ip string) []throttleKey {
+	var keys []throttleKey
+	if email = strings.ToLower(strings.TrimSpace(email)); config.PasswordResetMaxRequests > 0 && email != "" {
+		keys = append(keys, throttleKey{models.ThrottleResetEmail, email, config.PasswordResetMaxRequests})
+	}
+	if config.PasswordResetIPMaxRequests > 0 && ip != "" {
+		keys = append(keys, throttleKey{models.ThrottleResetIP, ip, config.PasswordResetIPMaxRequests})
+	}
+	return keys
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"talkFlow/config"
+	"talkFlow/models"
+	"talkFlow/store"
+	"time"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// 刷新令牌只在数据库中保存哈希，数据库泄露也无法直接使用
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 签发刷新令牌，family 为空时视为一次新的登录会话
+func IssueRefreshToken(ctx context.Context, username, family, ip string) (string, error) {
+	if config.Store == nil {
+		return "", errors.New("database is not initialized")
+	}
+
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if family == "" {
+		if family, err = RandomToken(16); err != nil {
+			return "", err
+		}
+	}
+
+	now := time.Now()
+	err = config.Store.Tokens.CreateRefreshToken(ctx, &models.RefreshToken{
+		Username:  username,
+		TokenHash: hashToken(token),
+		Family:    family,
+		ExpiresAt: now.Add(config.RefreshTokenTTL),
+		CreatedAt: now,
+		IP:        ip,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// 轮换刷新令牌：旧令牌作废并在同一会话下签发新令牌。
+// 已作废的令牌再次出现说明可能被盗用，此时整个会话都会被吊销。
+func RotateRefreshToken(ctx context.Context, token, ip string) (string, string, error) {
+	if config.Store == nil {
+		return "", "", errors.New("database is not initialized")
+	}
+
+	rt, err := config.Store.Tokens.GetRefreshToken(ctx, hashToken(token))
+	if err == store.ErrNotFound {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if rt.Revoked {
+		if err := RevokeRefreshFamily(ctx, rt.Family); err != nil {
+			log.Printf("吊销刷新令牌会话失败: %v", err)
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+	if time.Now().After(rt.ExpiresAt) {
+		return "", "", ErrRefreshTokenExpired
+	}
+
+	// 并发刷新时只有一个请求能成功吊销旧令牌
+	ok, err := config.Store.Tokens.RevokeRefreshToken(ctx, rt.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", ErrRefreshTokenReused
+	}
+
+	newToken, err := IssueRefreshToken(ctx, rt.Username, rt.Family, ip)
+	if err != nil {
+		return "", "", err
+	}
+	return rt.Username, newToken, nil
+}
+
+// 吊销用户某个刷新令牌所在的整个会话，令牌不属于该用户时视为无效
+func RevokeRefreshToken(ctx context.Context, token, username string) error {
+	rt, err := config.Store.Tokens.GetRefreshToken(ctx, hashToken(token))
+	if err == store.ErrNotFound || (err == nil && rt.Username != username) {
+		return ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeRefreshFamily(ctx, rt.Family)
+}
+
+func RevokeRefreshFamily(ctx context.Context, family string) error {
+	return config.Store.Tokens.RevokeRefreshFamily(ctx, family)
+}
+
+// 吊销用户的所有刷新令牌（退出所有设备）
+func RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	return config.Store.Tokens.RevokeUserRefreshTokens(ctx, username)
+}
+
+// 将访问令牌的 jti 加入黑名单，记录保留到令牌自然过期为止
+func RevokeJTI(ctx context.Context, jti, username string, expiresAt time.Time) error {
+	return config.Store.Tokens.RevokeJTI(ctx, jti, username, expiresAt)
+}
+
+// 使用只能使用一次的令牌：jti 加入黑名单，已被使用过时返回 false
+func ConsumeJTI(ctx context.Context, jti, username string, expiresAt time.Time) (bool, error) {
+	return config.Store.Tokens.ConsumeJTI(ctx, jti, username, expiresAt)
+}
+
+// 访问令牌是否签发于用户最近一次重置密码之前（用户已删除时同样视为失效）。
+// iat 只精确到秒，与重置同一秒内签发的令牌也视为失效。
+func IssuedBeforePasswordReset(ctx context.Context, username string, issuedAt time.Time) (bool, error) {
+	user, err := config.Store.Users.GetByUsername(ctx, username)
+	if err == store.ErrNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.TokensValidAfter.Valid && issuedAt.Unix() <= user.TokensValidAfter.Time.Unix(), nil
+}
+
+func IsJTIRevoked(ctx context.Context, jti string) (bool, error) {
+	if config.Store == nil {
+		return false, errors.New("database is not initialized")
+	}
+	return config.Store.Tokens.IsJTIRevoked(ctx, jti)
+}
+
+// 定时清理已过期的黑名单、刷新令牌、登录失败记录和加入码失败记录（main 启动时调用一次即可）
+func StartTokenCleaner() {
+	go func() {
+		for {
+			time.Sleep(time.Hour)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := config.Store.Tokens.PurgeExpired(ctx, time.Now()); err != nil {
+				log.Printf("清理过期令牌失败: %v", err)
+			}
+			if err := config.Store.Throttles.Purge(ctx, time.Now().Add(-config.LoginFailureWindow)); err != nil {
+				log.Printf("清理登录失败记录失败: %v", err)
+			}
+			if err := config.Store.JoinFailures.Purge(ctx, time.Now().Add(-config.JoinAuditRetention)); err != nil {
+				log.Printf("清理加入码失败记录失败: %v", err)
+			}
+			cancel()
+		}
+	}()
+}